@@ -0,0 +1,65 @@
+package adc
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ADC is one analog-to-digital converter. Read returns the raw count for a
+// channel.
+type ADC interface {
+	Read(channel int) (int, error)
+	Close() error
+}
+
+// RMS samples a channel n times, interval apart, and returns the RMS of the
+// readings about their mean (so the bias of an AC current transformer drops
+// out), in ADC counts.
+func RMS(a ADC, channel int, n int, interval time.Duration) (float64, error) {
+	if n <= 0 {
+		return 0, errors.New("no samples")
+	}
+	samples := make([]float64, n)
+	var sum float64
+	for i := range samples {
+		v, err := a.Read(channel)
+		if err != nil {
+			return 0, err
+		}
+		samples[i] = float64(v)
+		sum += samples[i]
+		if interval > 0 {
+			time.Sleep(interval)
+		}
+	}
+	mean := sum / float64(n)
+
+	var sq float64
+	for _, s := range samples {
+		d := s - mean
+		sq += d * d
+	}
+	return math.Sqrt(sq / float64(n)), nil
+}
+
+// Mock is an ADC that plays back canned samples, for tests and for running
+// without hardware. Every channel reads from the same samples, wrapping
+// around at the end.
+type Mock struct {
+	Samples []int
+	pos     int
+}
+
+func (m *Mock) Read(channel int) (int, error) {
+	if len(m.Samples) == 0 {
+		return 0, nil
+	}
+	v := m.Samples[m.pos%len(m.Samples)]
+	m.pos++
+	return v, nil
+}
+
+func (m *Mock) Close() error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package adc
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestRMS(t *testing.T) {
+	tests := []struct {
+		samples []int
+		want    float64
+	}{
+		{[]int{512}, 0},                    // DC bias only
+		{[]int{612, 412}, 100},             // Square wave about the bias
+		{[]int{512, 612, 512, 412}, 70.71}, // Triangle-ish
+	}
+	for _, tt := range tests {
+		rms, err := RMS(&Mock{Samples: tt.samples}, 0, 200, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(rms-tt.want) > 0.01 {
+			t.Errorf("%v: RMS %.2f, want %.2f", tt.samples, rms, tt.want)
+		}
+	}
+	if _, err := RMS(&Mock{}, 0, 0, 0); err == nil {
+		t.Error("no samples accepted")
+	}
+}
+
+type failADC struct{}
+
+func (failADC) Read(channel int) (int, error) { return 0, errors.New("bus error") }
+func (failADC) Close() error                  { return nil }
+
+func TestRMSError(t *testing.T) {
+	if _, err := RMS(failADC{}, 0, 10, 0); err == nil || err.Error() != "bus error" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestMock(t *testing.T) {
+	m := &Mock{Samples: []int{1, 2, 3}}
+	for i, want := range []int{1, 2, 3, 1, 2} {
+		if v, _ := m.Read(i % 4); v != want {
+			t.Errorf("read %d got %d, want %d", i, v, want)
+		}
+	}
+	if v, err := (&Mock{}).Read(0); v != 0 || err != nil {
+		t.Errorf("empty mock got %d, %v", v, err)
+	}
+}
@@ -0,0 +1,75 @@
+package adc
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+const i2cSlave = 0x0703
+
+// ADS1115 is a 4 channel, 16 bit I2C ADC on an i2c-dev device. It runs in
+// continuous mode at 860 samples/sec, +/-4.096V.
+type ADS1115 struct {
+	f       *os.File
+	channel int
+}
+
+// OpenADS1115 opens e.g. /dev/i2c-1. addr of 0 uses 0x48.
+func OpenADS1115(device string, addr int) (*ADS1115, error) {
+	if addr == 0 {
+		addr = 0x48
+	}
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open i2c: %w", err)
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), i2cSlave, uintptr(addr))
+	if errno != 0 {
+		f.Close()
+		return nil, fmt.Errorf("i2c address 0x%x: %w", addr, errno)
+	}
+	return &ADS1115{f: f, channel: -1}, nil
+}
+
+// Switch the multiplexer to a single-ended channel
+func (a *ADS1115) selectChannel(channel int) error {
+	config := uint16(0x4+channel)<<12 | // MUX AINx vs GND
+		0x1<<9 | // PGA +/-4.096V
+		0x0<<8 | // Continuous
+		0x7<<5 | // 860 SPS
+		0x3 // Comparator off
+	if _, err := a.f.Write([]byte{0x01, byte(config >> 8), byte(config)}); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	// Point back at the conversion register
+	if _, err := a.f.Write([]byte{0x00}); err != nil {
+		return fmt.Errorf("write pointer: %w", err)
+	}
+	a.channel = channel
+	// Let the first conversion on the new channel finish
+	time.Sleep(3 * time.Millisecond)
+	return nil
+}
+
+// Read returns the latest conversion on channel 0-3.
+func (a *ADS1115) Read(channel int) (int, error) {
+	if channel < 0 || channel > 3 {
+		return 0, fmt.Errorf("bad channel %d", channel)
+	}
+	if channel != a.channel {
+		if err := a.selectChannel(channel); err != nil {
+			return 0, err
+		}
+	}
+	buf := make([]byte, 2)
+	if _, err := a.f.Read(buf); err != nil {
+		return 0, fmt.Errorf("read conversion: %w", err)
+	}
+	return int(int16(uint16(buf[0])<<8 | uint16(buf[1]))), nil
+}
+
+func (a *ADS1115) Close() error {
+	return a.f.Close()
+}
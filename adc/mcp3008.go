@@ -0,0 +1,101 @@
+package adc
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// spidev ioctls
+const (
+	spiIocMessage1  = 0x40206b00 // SPI_IOC_MESSAGE(1)
+	spiIocWrMode    = 0x40016b01
+	spiIocWrMaxHz   = 0x40046b04
+	spiIocWrBitsPer = 0x40016b03
+)
+
+// struct spi_ioc_transfer
+type spiTransfer struct {
+	txBuf       uint64
+	rxBuf       uint64
+	length      uint32
+	speedHz     uint32
+	delayUsecs  uint16
+	bitsPerWord uint8
+	csChange    uint8
+	txNbits     uint8
+	rxNbits     uint8
+	wordDelay   uint8
+	pad         uint8
+}
+
+// MCP3008 is an 8 channel, 10 bit SPI ADC on a spidev device.
+type MCP3008 struct {
+	f       *os.File
+	speedHz uint32
+}
+
+// OpenMCP3008 opens e.g. /dev/spidev0.0. speedHz of 0 uses 1MHz.
+func OpenMCP3008(device string, speedHz uint32) (*MCP3008, error) {
+	if speedHz == 0 {
+		speedHz = 1000000
+	}
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open spi: %w", err)
+	}
+	m := &MCP3008{f: f, speedHz: speedHz}
+
+	mode := uint8(0)
+	bits := uint8(8)
+	if err := m.ioctl(spiIocWrMode, unsafe.Pointer(&mode)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("spi mode: %w", err)
+	}
+	if err := m.ioctl(spiIocWrBitsPer, unsafe.Pointer(&bits)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("spi bits: %w", err)
+	}
+	if err := m.ioctl(spiIocWrMaxHz, unsafe.Pointer(&speedHz)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("spi speed: %w", err)
+	}
+	return m, nil
+}
+
+func (m *MCP3008) ioctl(req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, m.f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Read does a single-ended conversion on channel 0-7.
+func (m *MCP3008) Read(channel int) (int, error) {
+	if channel < 0 || channel > 7 {
+		return 0, fmt.Errorf("bad channel %d", channel)
+	}
+	tx := []byte{0x01, byte(0x80 | channel<<4), 0x00}
+	rx := make([]byte, 3)
+	xfer := spiTransfer{
+		txBuf:       uint64(uintptr(unsafe.Pointer(&tx[0]))),
+		rxBuf:       uint64(uintptr(unsafe.Pointer(&rx[0]))),
+		length:      3,
+		speedHz:     m.speedHz,
+		bitsPerWord: 8,
+	}
+	err := m.ioctl(spiIocMessage1, unsafe.Pointer(&xfer))
+	runtime.KeepAlive(tx)
+	runtime.KeepAlive(rx)
+	if err != nil {
+		return 0, fmt.Errorf("spi transfer: %w", err)
+	}
+	return int(rx[1]&0x03)<<8 | int(rx[2]), nil
+}
+
+func (m *MCP3008) Close() error {
+	return m.f.Close()
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hjkoskel/govattu"
+	"goratt/sound"
+)
+
+// Audible feedback. Each event has a sound - a tone sequence for a piezo
+// buzzer, or a WAV file played through ALSA. Without a Buzzer pin, tones
+// are synthesized and played through ALSA too. Quiet hours turn the
+// volume down, except for alarms.
+
+type SoundConfig struct {
+	Buzzer      *uint8            `yaml:"Buzzer"`      // GPIO pin. 13 or 19 for PWM tones
+	Device      string            `yaml:"Device"`      // ALSA device for aplay (Default is the default)
+	Volume      *int              `yaml:"Volume"`      // 0-100 (Default 100)
+	QuietVolume int               `yaml:"QuietVolume"` // Volume in quiet hours (Default 0, silent)
+	QuietHours  []TimeWindow      `yaml:"QuietHours"`
+	Sounds      map[string]string `yaml:"Sounds"`      // Event -> "freq/ms ..." tones, a .wav file, or "off"
+	DoorbellPin *uint8            `yaml:"DoorbellPin"` // Doorbell button, active low
+}
+
+var soundDefaults = map[string]string{
+	"granted":         "1320/80 0/40 1760/120",
+	"denied":          "220/300 0/100 220/300",
+	"timeout-warning": "880/100 0/100 880/100 0/100 880/100",
+	"alarm":           "1760/250 1320/250 1760/250 1320/250 1760/250 1320/250",
+	"doorbell":        "1320/300 1047/500",
+}
+
+// Doorbell rung - off the wire
+type DoorbellEvent struct {
+	Time string `json:"time"`
+}
+
+var sounds = make(map[string]sound.Sound)
+var buzzerSink sound.Sink
+var audioSink sound.Sink
+var soundQueue = make(chan string, 4)
+
+// Check the sound config and open the outputs at startup
+func loadSound() {
+	sc := cfg.Sound
+	if sc == nil {
+		return
+	}
+	var err error
+	if sounds, err = parseSounds(sc); err != nil {
+		log.Fatal("Sound config: ", err)
+	}
+
+	audioSink = sound.NewAplay(sc.Device)
+	if sc.Buzzer != nil {
+		b, err := sound.OpenBuzzer(*sc.Buzzer, func(hw govattu.Vattu, on bool) { pwmEnable(hw, 1, on) })
+		if err != nil {
+			log.Fatal("Error opening buzzer: ", err)
+		}
+		buzzerSink = b
+	}
+}
+
+// Check the config and work out each event's sound - the default, the
+// configured one, or none if it is "off"
+func parseSounds(sc *SoundConfig) (map[string]sound.Sound, error) {
+	for name := range sc.Sounds {
+		if _, ok := soundDefaults[name]; !ok {
+			return nil, fmt.Errorf("unknown sound \"%s\"", name)
+		}
+	}
+	for i := range sc.QuietHours {
+		if err := sc.QuietHours[i].init(); err != nil {
+			return nil, fmt.Errorf("QuietHours: %w", err)
+		}
+	}
+
+	parsed := make(map[string]sound.Sound)
+	for name, def := range soundDefaults {
+		str := def
+		if s, ok := sc.Sounds[name]; ok {
+			str = s
+		}
+		if str == "" || str == "off" {
+			continue
+		}
+		s, err := sound.Parse(str)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		parsed[name] = s
+	}
+	return parsed, nil
+}
+
+// Volume for an event right now
+func soundVolume(name string) int {
+	sc := cfg.Sound
+	volume := 100
+	if sc.Volume != nil {
+		volume = *sc.Volume
+	}
+	if name == "alarm" {
+		return volume
+	}
+	now := time.Now().In(scheduleLocation)
+	for i := range sc.QuietHours {
+		if sc.QuietHours[i].contains(now) {
+			return sc.QuietVolume
+		}
+	}
+	return volume
+}
+
+// Play an event's sound, if it has one. Doesn't wait for it.
+func soundPlay(name string) {
+	if cfg.Sound == nil {
+		return
+	}
+	if _, ok := sounds[name]; !ok {
+		return
+	}
+	for {
+		select {
+		case soundQueue <- name:
+			return
+		default:
+		}
+		if name != "alarm" {
+			debugf("Sound queue full - dropping %s\n", name)
+			return
+		}
+		// Alarms are never dropped - make room
+		select {
+		case dropped := <-soundQueue:
+			debugf("Sound queue full - dropping %s for alarm\n", dropped)
+		default:
+		}
+	}
+}
+
+// Play queued sounds one at a time
+func SoundPlayer() {
+	if cfg.Sound == nil {
+		return
+	}
+	for name := range soundQueue {
+		soundPlayNow(name)
+	}
+}
+
+// Play one sound and wait for it - files through ALSA, tones on the buzzer
+// if there is one
+func soundPlayNow(name string) {
+	volume := soundVolume(name)
+	if volume <= 0 {
+		return
+	}
+	s := sounds[name]
+	sink := audioSink
+	if s.File == "" && buzzerSink != nil {
+		sink = buzzerSink
+	}
+	if err := sink.Play(s, volume); err != nil {
+		fmt.Printf("Error playing %s sound: %v\n", name, err)
+	}
+}
+
+// Watch the doorbell button
+func DoorbellMonitor() {
+	sc := cfg.Sound
+	if sc == nil || sc.DoorbellPin == nil {
+		return
+	}
+	hw, err := govattu.Open()
+	if err != nil {
+		log.Fatal("Doorbell input: ", err)
+	}
+	defer hw.Close()
+	hw.PinMode(*sc.DoorbellPin, govattu.ALTinput)
+	hw.PullMode(*sc.DoorbellPin, govattu.PULLup)
+
+	var last time.Time
+	wasPressed := false
+	for {
+		pressed := !hw.ReadPinLevel(*sc.DoorbellPin)
+		if pressed && !wasPressed && time.Since(last) > 2*time.Second {
+			last = time.Now()
+			fmt.Println("Doorbell")
+			soundPlay("doorbell")
+			message, _ := json.Marshal(DoorbellEvent{Time: last.Format(time.RFC3339)})
+			var topic string = fmt.Sprintf("ratt/status/node/%s/doorbell", cfg.ClientID)
+			client.Publish(topic, 0, false, message)
+		}
+		wasPressed = pressed
+		time.Sleep(50 * time.Millisecond)
+	}
+}
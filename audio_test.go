@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"goratt/sound"
+)
+
+func testSound(t *testing.T, buzzer bool) (*sound.Mock, *sound.Mock) {
+	volume := 80
+	cfg.Sound = &SoundConfig{
+		Volume:      &volume,
+		QuietVolume: 10,
+		Sounds:      map[string]string{"doorbell": "/tmp/bell.wav", "denied": "off"},
+	}
+	var err error
+	if sounds, err = parseSounds(cfg.Sound); err != nil {
+		t.Fatal(err)
+	}
+	audio := &sound.Mock{Files: true}
+	audioSink = audio
+	var buzz *sound.Mock
+	buzzerSink = nil
+	if buzzer {
+		buzz = &sound.Mock{}
+		buzzerSink = buzz
+	}
+	t.Cleanup(func() {
+		cfg.Sound = nil
+		audioSink, buzzerSink = nil, nil
+		for len(soundQueue) > 0 {
+			<-soundQueue
+		}
+	})
+	return audio, buzz
+}
+
+func TestParseSounds(t *testing.T) {
+	s, err := parseSounds(&SoundConfig{Sounds: map[string]string{"denied": "off", "granted": "440/50"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s["denied"]; ok {
+		t.Error("sound set to off parsed")
+	}
+	if g := s["granted"]; len(g.Tones) != 1 || g.Tones[0].Freq != 440 {
+		t.Errorf("granted got %+v", g)
+	}
+	if len(s["alarm"].Tones) == 0 {
+		t.Error("default alarm missing")
+	}
+
+	bad := []*SoundConfig{
+		{Sounds: map[string]string{"chime": "440/50"}},
+		{Sounds: map[string]string{"granted": "440"}},
+		{QuietHours: []TimeWindow{{Start: "22:00", End: "25:00"}}},
+	}
+	for _, sc := range bad {
+		if _, err := parseSounds(sc); err == nil {
+			t.Errorf("%+v accepted", sc)
+		}
+	}
+}
+
+func TestSoundRouting(t *testing.T) {
+	audio, buzz := testSound(t, true)
+	soundPlayNow("granted")
+	soundPlayNow("doorbell")
+	if log := buzz.Log(); len(log) != 1 || len(log[0].Sound.Tones) != 3 || log[0].Volume != 80 {
+		t.Errorf("buzzer got %+v", log)
+	}
+	if log := audio.Log(); len(log) != 1 || log[0].Sound.File != "/tmp/bell.wav" {
+		t.Errorf("ALSA got %+v", log)
+	}
+
+	// No buzzer - tones go through ALSA too
+	audio, _ = testSound(t, false)
+	soundPlayNow("granted")
+	if log := audio.Log(); len(log) != 1 || len(log[0].Sound.Tones) != 3 {
+		t.Errorf("ALSA got %+v", log)
+	}
+}
+
+func TestSoundOff(t *testing.T) {
+	testSound(t, true)
+	soundPlay("denied")
+	if len(soundQueue) != 0 {
+		t.Error("sound set to off was queued")
+	}
+}
+
+func TestSoundQuietHours(t *testing.T) {
+	testSound(t, true)
+	now := time.Now().In(scheduleLocation)
+	w := TimeWindow{Start: now.Add(-time.Hour).Format("15:04"), End: now.Add(time.Hour).Format("15:04")}
+	if err := w.init(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Sound.QuietHours = []TimeWindow{w}
+	if v := soundVolume("granted"); v != 10 {
+		t.Errorf("quiet hours volume %d", v)
+	}
+	if v := soundVolume("alarm"); v != 80 {
+		t.Errorf("alarm in quiet hours volume %d", v)
+	}
+
+	_, buzz := testSound(t, true)
+	cfg.Sound.QuietHours = []TimeWindow{w}
+	cfg.Sound.QuietVolume = 0
+	soundPlayNow("granted")
+	if log := buzz.Log(); len(log) != 0 {
+		t.Errorf("played in silent quiet hours: %+v", log)
+	}
+}
+
+func TestSoundAlarmNeverDropped(t *testing.T) {
+	testSound(t, true)
+	for i := 0; i < cap(soundQueue)+2; i++ {
+		soundPlay("granted")
+	}
+	soundPlay("alarm")
+	if len(soundQueue) != cap(soundQueue) {
+		t.Fatalf("queue has %d", len(soundQueue))
+	}
+	alarm := false
+	for len(soundQueue) > 0 {
+		if <-soundQueue == "alarm" {
+			alarm = true
+		}
+	}
+	if !alarm {
+		t.Error("alarm dropped from a full queue")
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/hjkoskel/govattu"
+	"golang.org/x/sys/unix"
+)
+
+// "goratt calibrate" - find ServoOpen and ServoClose by moving the servo
+// from the keyboard, try the open/close cycle, and save the values back to
+// the config file.
+
+var calibrateSteps = []int{1, 5, 10, 50, 100}
+
+const calibrateHelp = `Servo calibration
+  Left/Right, Up/Down  Move the servo
+  + -                  Bigger/smaller steps
+  o c                  Set this position as ServoOpen / ServoClose
+  t                    Test - close, open, wait, close
+  w                    Write ServoOpen/ServoClose to %s and quit
+  q                    Quit without saving
+`
+
+// Put the terminal in raw mode, for single keypresses. Returns the old
+// settings.
+func rawTerminal(fd int) (*unix.Termios, error) {
+	old, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	raw := *old
+	raw.Lflag &^= unix.ICANON | unix.ECHO | unix.ISIG
+	raw.Iflag &^= unix.ICRNL | unix.IXON
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// Read a key - a character, or "up", "down", "left", "right"
+func readKey(f *os.File) (string, error) {
+	buf := make([]byte, 8)
+	n, err := f.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	if n >= 3 && buf[0] == 0x1b && buf[1] == '[' {
+		switch buf[2] {
+		case 'A':
+			return "up", nil
+		case 'B':
+			return "down", nil
+		case 'C':
+			return "right", nil
+		case 'D':
+			return "left", nil
+		}
+		return "", nil
+	}
+	return string(buf[:1]), nil
+}
+
+// Set ServoOpen and ServoClose in the config file, leaving everything else
+// (indents, comments on those lines, CRLF line endings) as it was
+func saveServoConfig(file string, open int, close int) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	eol := "\n"
+	if bytes.Contains(data, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+	for _, kv := range []struct {
+		key   string
+		value int
+	}{{"ServoOpen", open}, {"ServoClose", close}} {
+		re := regexp.MustCompile(`(?m)^([ \t]*` + kv.key + `:)([ \t]*)[^\s#]*([ \t]*(#.*)?\r?)$`)
+		value := strconv.Itoa(kv.value)
+		if re.Match(data) {
+			data = re.ReplaceAllFunc(data, func(line []byte) []byte {
+				m := re.FindSubmatch(line)
+				space := m[2]
+				if len(space) == 0 {
+					space = []byte(" ") // "ServoOpen:" with no value
+				}
+				rest := m[3]
+				if bytes.HasPrefix(rest, []byte("#")) {
+					rest = append([]byte(" "), rest...) // Or the comment joins the value
+				}
+				return bytes.Join([][]byte{m[1], space, []byte(value), rest}, nil)
+			})
+		} else {
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				data = append(data, eol...)
+			}
+			data = append(data, kv.key+": "+value+eol...)
+		}
+	}
+
+	mode := os.FileMode(0644)
+	if st, err := os.Stat(file); err == nil {
+		mode = st.Mode().Perm()
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func Calibrate(cfgfile string) {
+	if cfg.DoorPin == nil {
+		log.Fatal("Calibrate needs DoorPin")
+	}
+	if cfg.Mode != "servo" {
+		fmt.Printf("Warning: Mode is \"%s\", not servo\n", cfg.Mode)
+	}
+	hw, err := govattu.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer hw.Close()
+	hw.PinMode(uint8(*cfg.DoorPin), servoAlt(*cfg.DoorPin)) // PWM0 function
+	pwmEnable(hw, 0, true)
+	hw.PwmSetClock(19)     // Set clock divisor to get 50Hz frequency
+	hw.Pwm0SetRange(20000) // SET RANGE to get 1ms - 2ms pulse width
+
+	openPos, closePos := cfg.ServoOpen, cfg.ServoClose
+	pos := closePos
+	if pos == 0 {
+		pos = 1500 // Center
+	}
+	hw.Pwm0Set(uint32(pos))
+
+	fd := int(os.Stdin.Fd())
+	old, err := rawTerminal(fd)
+	if err != nil {
+		log.Fatal("Calibrate needs a terminal: ", err)
+	}
+	restore := func() { unix.IoctlSetTermios(fd, unix.TCSETS, old) }
+	defer restore()
+
+	// Killed part way - don't leave the terminal raw
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGHUP, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		s := <-sig
+		restore()
+		fmt.Printf("\r\nCalibration stopped: %v\n", s)
+		os.Exit(1)
+	}()
+
+	fmt.Printf(calibrateHelp, cfgfile)
+	step := 2 // Index into calibrateSteps
+	for {
+		fmt.Printf("\r\033[KPulse %4dus  step %3d  open %4d  close %4d ", pos, calibrateSteps[step], openPos, closePos)
+		key, err := readKey(os.Stdin)
+		if err != nil {
+			fmt.Println("\r\nError reading keyboard:", err)
+			return
+		}
+		switch key {
+		case "up", "right":
+			pos += calibrateSteps[step]
+		case "down", "left":
+			pos -= calibrateSteps[step]
+		case "+", "=":
+			if step < len(calibrateSteps)-1 {
+				step++
+			}
+		case "-":
+			if step > 0 {
+				step--
+			}
+		case "o":
+			openPos = pos
+		case "c":
+			closePos = pos
+		case "t":
+			if openPos == 0 || closePos == 0 {
+				fmt.Print("\r\033[KSet open and close first")
+				time.Sleep(time.Second)
+				continue
+			}
+			fmt.Print("\r\033[KTesting")
+			servoMove(hw, pos, closePos)
+			servoMove(hw, closePos, openPos)
+			time.Sleep(2 * time.Second)
+			servoMove(hw, openPos, closePos)
+			pos = closePos
+		case "w":
+			if openPos == 0 || closePos == 0 {
+				fmt.Print("\r\033[KSet open and close first")
+				time.Sleep(time.Second)
+				continue
+			}
+			if err := saveServoConfig(cfgfile, openPos, closePos); err != nil {
+				fmt.Println("\r\nError saving config:", err)
+				continue
+			}
+			fmt.Printf("\r\nSaved ServoOpen %d ServoClose %d to %s\r\n", openPos, closePos, cfgfile)
+			servoMove(hw, pos, closePos)
+			return
+		case "q", "\x03":
+			fmt.Print("\r\n")
+			if closePos != 0 {
+				servoMove(hw, pos, closePos)
+			}
+			return
+		}
+		if pos < 500 {
+			pos = 500
+		}
+		if pos > 2500 {
+			pos = 2500
+		}
+		hw.Pwm0Set(uint32(pos))
+	}
+}
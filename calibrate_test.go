@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSaveServoConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain",
+			"ClientID: door\nServoOpen: 1000\nServoClose: 2000\n",
+			"ClientID: door\nServoOpen: 1100\nServoClose: 1900\n"},
+		{"comments",
+			"ServoOpen: 1000   # Latch clear\nServoClose: 2000 # Latched\n",
+			"ServoOpen: 1100   # Latch clear\nServoClose: 1900 # Latched\n"},
+		{"crlf",
+			"ClientID: door\r\nServoOpen: 1000\r\nServoClose: 2000 # Latched\r\n",
+			"ClientID: door\r\nServoOpen: 1100\r\nServoClose: 1900 # Latched\r\n"},
+		{"indented",
+			"  ClientID: door\n  ServoOpen: 1000\n  ServoClose: 2000\n",
+			"  ClientID: door\n  ServoOpen: 1100\n  ServoClose: 1900\n"},
+		{"missing",
+			"ClientID: door",
+			"ClientID: door\nServoOpen: 1100\nServoClose: 1900\n"},
+		{"no value",
+			"ServoOpen:#Latch clear\nServoClose:\n",
+			"ServoOpen: 1100 #Latch clear\nServoClose: 1900\n"},
+		{"missing crlf",
+			"ClientID: door\r\nServoOpen:\r\n",
+			"ClientID: door\r\nServoOpen: 1100\r\nServoClose: 1900\r\n"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		file := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-")+".cfg")
+		if err := ioutil.WriteFile(file, []byte(tt.in), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := saveServoConfig(file, 1100, 1900); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		data, _ := ioutil.ReadFile(file)
+		if string(data) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, data, tt.want)
+		}
+		// yaml.v2 rejects duplicate keys, so this also checks nothing was
+		// appended twice
+		var c RattConfig
+		if err := yaml.UnmarshalStrict(data, &c); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if c.ServoOpen != 1100 || c.ServoClose != 1900 {
+			t.Errorf("%s: decoded open %d close %d", tt.name, c.ServoOpen, c.ServoClose)
+		}
+	}
+}
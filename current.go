@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"goratt/adc"
+)
+
+// Current sensing for the tool personality. A current transformer on an ADC
+// channel tells us when the tool is actually running, so a long cut doesn't
+// hit the idle timeout, and lets us report how long the tool ran in each
+// session.
+
+type CurrentSenseConfig struct {
+	ADC          string  `yaml:"ADC"`     // "mcp3008", "ads1115" or "mock"
+	Device       string  `yaml:"Device"`  // /dev/spidev0.0, /dev/i2c-1
+	Address      int     `yaml:"Address"` // ADS1115 I2C address (Default 0x48)
+	Channel      int     `yaml:"Channel"`
+	Samples      int     `yaml:"Samples"`      // Samples per RMS reading (Default 200)
+	AmpsPerCount float64 `yaml:"AmpsPerCount"` // RMS counts to amps (Default 1)
+	Threshold    float64 `yaml:"Threshold"`    // Amps at or above this is running
+	MockSamples  []int   `yaml:"MockSamples"`  // Readings the mock ADC plays back
+}
+
+// Tool running state change - off the wire
+type RunningEvent struct {
+	Running bool    `json:"running"`
+	Amps    float64 `json:"amps"`
+	Member  string  `json:"member,omitempty"`
+}
+
+// Gap between samples - 200 of these cover several mains cycles
+const currentSampleInterval = 500 * time.Microsecond
+
+// The ADC in use. Anything implementing adc.ADC (like adc.Mock) can stand in.
+var toolADC adc.ADC
+
+func openADC(cs *CurrentSenseConfig) (adc.ADC, error) {
+	switch cs.ADC {
+	case "mcp3008":
+		return adc.OpenMCP3008(cs.Device, 0)
+	case "ads1115":
+		return adc.OpenADS1115(cs.Device, cs.Address)
+	case "mock":
+		return &adc.Mock{Samples: cs.MockSamples}, nil
+	}
+	return nil, fmt.Errorf("unknown ADC \"%s\"", cs.ADC)
+}
+
+// Open the ADC at startup, if current sensing is configured
+func loadCurrentSense() {
+	tc := toolConfig()
+	if tc.CurrentSense == nil {
+		return
+	}
+	if cfg.Personality != "tool" {
+		log.Fatal("CurrentSense needs Personality: tool")
+	}
+	a, err := openADC(tc.CurrentSense)
+	if err != nil {
+		log.Fatal("Current sense: ", err)
+	}
+	toolADC = a
+}
+
+// Take one RMS reading, in amps
+func readCurrent(cs *CurrentSenseConfig) (float64, error) {
+	samples := cs.Samples
+	if samples <= 0 {
+		samples = 200
+	}
+	scale := cs.AmpsPerCount
+	if scale <= 0 {
+		scale = 1
+	}
+	rms, err := adc.RMS(toolADC, cs.Channel, samples, currentSampleInterval)
+	if err != nil {
+		return 0, err
+	}
+	return rms * scale, nil
+}
+
+func publishRunning(ev RunningEvent) {
+	message, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Println("Error encoding running event:", err)
+		return
+	}
+	var topic string = fmt.Sprintf("ratt/status/node/%s/personality/running", cfg.ClientID)
+	client.Publish(topic, 0, false, message)
+}
+
+// Watch the current once a second. While the tool runs, the session is
+// active and accumulates run time.
+func CurrentSense() {
+	cs := toolConfig().CurrentSense
+	if cs == nil || toolADC == nil {
+		return
+	}
+	running := false
+	last := time.Now()
+	for {
+		time.Sleep(time.Second)
+		amps, err := readCurrent(cs)
+		now := time.Now()
+		elapsed := now.Sub(last)
+		last = now
+		if err != nil {
+			fmt.Println("Current sense error:", err)
+			countMetric("current.errors")
+			continue
+		}
+		debugf("Current %.2fA\n", amps)
+
+		if running {
+			// Count the interval it was running through
+			toolRunning(elapsed)
+		}
+		if (amps >= cs.Threshold) != running {
+			running = !running
+			ev := RunningEvent{Running: running, Amps: amps}
+			toolMutex.Lock()
+			if session != nil {
+				ev.Member = session.tag.Member
+			}
+			toolMutex.Unlock()
+			fmt.Printf("Tool running: %v (%.2fA)\n", running, amps)
+			publishRunning(ev)
+		}
+		if running {
+			toolActivity()
+		}
+	}
+}
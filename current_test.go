@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"goratt/adc"
+)
+
+func TestOpenADCMock(t *testing.T) {
+	a, err := openADC(&CurrentSenseConfig{ADC: "mock", MockSamples: []int{7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := a.Read(0); v != 7 {
+		t.Errorf("mock read %d", v)
+	}
+	if _, err := openADC(&CurrentSenseConfig{ADC: "ad7705"}); err == nil {
+		t.Error("unknown ADC accepted")
+	}
+}
+
+func TestReadCurrent(t *testing.T) {
+	defer func() { toolADC = nil }()
+	cs := &CurrentSenseConfig{Samples: 20, AmpsPerCount: 0.03, Threshold: 0.5}
+
+	toolADC = &adc.Mock{Samples: []int{612, 412}}
+	amps, err := readCurrent(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(amps-3) > 0.001 || amps < cs.Threshold {
+		t.Errorf("running tool read %.3fA", amps)
+	}
+
+	toolADC = &adc.Mock{Samples: []int{512, 513, 512, 511}}
+	if amps, _ := readCurrent(cs); amps >= cs.Threshold {
+		t.Errorf("idle tool read %.3fA", amps)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"goratt/display"
+)
+
+// Status display. Shows a screen for what the node is doing (idle,
+// offline, tool session with its countdown, alarms), and for a few seconds
+// after each access event, a greeting or the reason for a denial. Every
+// screen is a layout of text/template lines that the config can replace.
+
+type DisplayConfig struct {
+	Type     string              `yaml:"Type"`     // "ssd1306" or "hd44780"
+	Device   string              `yaml:"Device"`   // Default /dev/i2c-1
+	Address  int                 `yaml:"Address"`  // Default 0x3c (ssd1306) or 0x27 (hd44780)
+	Cols     int                 `yaml:"Cols"`     // hd44780 size (Default 16x2)
+	Rows     int                 `yaml:"Rows"`     // ssd1306: 8 for 128x64 (Default), 4 for 128x32
+	ShowSecs int                 `yaml:"ShowSecs"` // How long event screens stay up (Default 5)
+	Layouts  map[string][]string `yaml:"Layouts"`
+}
+
+// What layouts can show
+type DisplayVars struct {
+	Node      string
+	Member    string
+	Nickname  string // Member if they have none
+	Reason    string
+	Warning   string
+	Countdown string // Tool session idle timeout, m:ss
+	State     string
+	Time      string
+}
+
+var displayLayouts = map[string]display.Layout{
+	"idle":    {"{{.Node}}", "{{if .State}}{{.State}}{{else}}Badge in{{end}}", "", "{{.Time}}"},
+	"offline": {"{{.Node}}", "OFFLINE", "", "{{.Time}}"},
+	"granted": {"Hi {{.Nickname}}", "{{.Warning}}"},
+	"denied":  {"Access denied", "{{.Reason}}", "{{.Warning}}"},
+	"tool":    {"{{.Nickname}}", "Idle off {{.Countdown}}", "{{.Warning}}"},
+	"alarm":   {"** {{.State}} **", "{{.Node}}"},
+}
+
+// Denial reasons, as members should see them
+var displayReasons = map[string]string{
+	"":           "Not authorized",
+	"unknown":    "Unknown badge",
+	"schedule":   "Outside hours",
+	"passback":   "Anti-passback",
+	"nopin":      "No PIN set",
+	"badpin":     "Wrong PIN",
+	"pintimeout": "PIN timeout",
+	"pinlockout": "PIN locked out",
+	"twoperson":  "Need 2nd person",
+	"estop":      "E-stop active",
+	"override":   "Badge revoked",
+}
+
+var screen display.Display
+var displayMutex sync.Mutex
+var displayUntil time.Time // Event screen up until
+var displayLast *display.Frame
+
+// Open the display at startup, if configured
+func loadDisplay() {
+	dc := cfg.Display
+	if dc == nil {
+		return
+	}
+	for name, lines := range dc.Layouts {
+		if _, ok := displayLayouts[name]; !ok {
+			log.Fatalf("Unknown display layout \"%s\"", name)
+		}
+		if _, err := display.Layout(lines).Render(20, len(lines), DisplayVars{}); err != nil {
+			log.Fatalf("Display layout %s: %v", name, err)
+		}
+		displayLayouts[name] = display.Layout(lines)
+	}
+
+	device := dc.Device
+	if device == "" {
+		device = "/dev/i2c-1"
+	}
+	var err error
+	switch dc.Type {
+	case "ssd1306":
+		height := 64
+		if dc.Rows == 4 {
+			height = 32
+		}
+		screen, err = display.OpenSSD1306(device, dc.Address, height)
+	case "hd44780":
+		screen, err = display.OpenHD44780(device, dc.Address, dc.Cols, dc.Rows)
+	default:
+		log.Fatalf("Unknown Display Type \"%s\"", dc.Type)
+	}
+	if err != nil {
+		log.Fatal("Error opening display: ", err)
+	}
+}
+
+func displaySecs() time.Duration {
+	if cfg.Display != nil && cfg.Display.ShowSecs > 0 {
+		return time.Duration(cfg.Display.ShowSecs) * time.Second
+	}
+	return 5 * time.Second
+}
+
+// Fill in the member's details
+func memberVars(member string) DisplayVars {
+	v := DisplayVars{Member: member, Nickname: member}
+	for _, tag := range validTags {
+		if tag.Member == member {
+			if tag.Nickname != "" {
+				v.Nickname = tag.Nickname
+			}
+			v.Warning = tag.Warning
+			break
+		}
+	}
+	return v
+}
+
+// Caller holds displayMutex
+func displayRender(name string, v DisplayVars) {
+	v.Node = cfg.ClientID
+	v.Time = time.Now().Format("Jan 2 15:04")
+	cols, rows := screen.Size()
+	f, err := displayLayouts[name].Render(cols, rows, v)
+	if err != nil {
+		fmt.Printf("Display layout %s: %v\n", name, err)
+		return
+	}
+	if f.Equal(displayLast) {
+		return
+	}
+	if err := screen.Show(f); err != nil {
+		fmt.Println("Display error:", err)
+		return
+	}
+	displayLast = f
+}
+
+// Put up an event screen for a few seconds
+func displayEvent(name string, v DisplayVars) {
+	if screen == nil {
+		return
+	}
+	displayMutex.Lock()
+	defer displayMutex.Unlock()
+	displayUntil = time.Now().Add(displaySecs())
+	displayRender(name, v)
+}
+
+// Show an access event
+func displayAccess(ev AccessEvent) {
+	if screen == nil {
+		return
+	}
+	v := memberVars(ev.Member)
+	if ev.Allowed == 1 {
+		displayEvent("granted", v)
+		return
+	}
+	v.Reason = displayReasons[ev.Reason]
+	if v.Reason == "" {
+		v.Reason = ev.Reason
+	}
+	displayEvent("denied", v)
+}
+
+// The screen for what the node is doing now
+func displayState() {
+	var name string
+	var v DisplayVars
+	switch state := ledState(); state {
+	case "estop":
+		name, v.State = "alarm", "E-STOP"
+	case "fire":
+		name, v.State = "alarm", "FIRE ALARM"
+	case "lockout":
+		name, v.State = "alarm", "LOCKED OUT"
+	case "offline":
+		name = "offline"
+	case "tool-active":
+		member, left := toolRemaining()
+		name, v = "tool", memberVars(member)
+		v.Countdown = fmt.Sprintf("%d:%02d", int(left.Minutes()), int(left.Seconds())%60)
+	case "enroll":
+		name, v.State = "idle", "Enrolling"
+	case "held-open":
+		name, v.State = "idle", "Unlocked"
+	default:
+		name = "idle"
+	}
+
+	displayMutex.Lock()
+	defer displayMutex.Unlock()
+	if time.Now().Before(displayUntil) {
+		return
+	}
+	displayRender(name, v)
+}
+
+// Keep the state screen (clock, countdown) up to date
+func DisplayUpdater() {
+	if screen == nil {
+		return
+	}
+	for {
+		displayState()
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,118 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"text/template"
+)
+
+// Status displays. Everything is laid out on a character Frame first; a
+// graphic display renders the frame with a built-in 5x7 font. Frames (and
+// rendered bitmaps) are plain data, so they can be compared against saved
+// snapshots.
+
+// Display is somewhere to show a frame
+type Display interface {
+	Size() (cols int, rows int)
+	Show(f *Frame) error
+	Close() error
+}
+
+// Frame is a screen of text
+type Frame struct {
+	Cols  int
+	Rows  int
+	Lines []string // Always Rows lines, each exactly Cols runes
+}
+
+func NewFrame(cols int, rows int) *Frame {
+	f := &Frame{Cols: cols, Rows: rows, Lines: make([]string, rows)}
+	for i := range f.Lines {
+		f.Lines[i] = strings.Repeat(" ", cols)
+	}
+	return f
+}
+
+// Set puts text on a row, cut or padded to fit. Rows off the screen are
+// ignored.
+func (f *Frame) Set(row int, text string) {
+	if row < 0 || row >= f.Rows {
+		return
+	}
+	r := []rune(text)
+	if len(r) > f.Cols {
+		r = r[:f.Cols]
+	}
+	f.Lines[row] = string(r) + strings.Repeat(" ", f.Cols-len(r))
+}
+
+// String is the whole frame, one line per row - handy for snapshots
+func (f *Frame) String() string {
+	return strings.Join(f.Lines, "\n") + "\n"
+}
+
+func (f *Frame) Equal(o *Frame) bool {
+	return o != nil && f.String() == o.String()
+}
+
+// Layout is one text/template per row
+type Layout []string
+
+// Render fills a frame from the layout. Rows past the end of the screen
+// are dropped.
+func (l Layout) Render(cols int, rows int, vars interface{}) (*Frame, error) {
+	f := NewFrame(cols, rows)
+	for i, line := range l {
+		if i >= rows {
+			break
+		}
+		t, err := template.New("line").Option("missingkey=zero").Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		var b bytes.Buffer
+		if err := t.Execute(&b, vars); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		f.Set(i, b.String())
+	}
+	return f, nil
+}
+
+// Buffer is a display that just keeps what it was last shown
+type Buffer struct {
+	Cols  int
+	Rows  int
+	Frame *Frame
+}
+
+func (b *Buffer) Size() (int, int) {
+	return b.Cols, b.Rows
+}
+
+func (b *Buffer) Show(f *Frame) error {
+	b.Frame = f
+	return nil
+}
+
+func (b *Buffer) Close() error {
+	return nil
+}
+
+const i2cSlave = 0x0703
+
+func openI2C(device string, addr int) (*os.File, error) {
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), i2cSlave, uintptr(addr))
+	if errno != 0 {
+		f.Close()
+		return nil, fmt.Errorf("i2c address 0x%x: %w", addr, errno)
+	}
+	return f, nil
+}
@@ -0,0 +1,125 @@
+package display
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the snapshots in testdata")
+
+// Compare against testdata/name, or rewrite it with -update
+func snapshot(t *testing.T, name string, got string) {
+	t.Helper()
+	file := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(file, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+type vars struct {
+	Member  string
+	Reason  string
+	Warning string
+}
+
+func TestLayoutSnapshots(t *testing.T) {
+	layout := Layout{"Hi {{.Member}}", "{{.Reason}}", "{{.Warning}}", "", "past the bottom"}
+	tests := []struct {
+		name       string
+		cols, rows int
+		vars       interface{}
+	}{
+		{"lcd16x2.txt", 16, 2, vars{Member: "alice", Reason: "Outside hours"}},
+		{"lcd20x4.txt", 20, 4, vars{Member: "bartholomew-the-long", Reason: "Wrong PIN", Warning: "Dues due 1 Jul"}},
+		{"oled21x8.txt", 21, 8, map[string]string{"Member": "bob", "Warning": "Renew soon"}},
+	}
+	for _, tc := range tests {
+		b := &Buffer{Cols: tc.cols, Rows: tc.rows}
+		f, err := layout.Render(tc.cols, tc.rows, tc.vars)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		b.Show(f)
+		for i, line := range b.Frame.Lines {
+			if len([]rune(line)) != tc.cols {
+				t.Errorf("%s: row %d is %d wide", tc.name, i, len([]rune(line)))
+			}
+		}
+		snapshot(t, tc.name, b.Frame.String())
+	}
+}
+
+func TestLayoutMissingKey(t *testing.T) {
+	f, err := (Layout{"[{{.Missing}}]"}).Render(4, 1, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Lines[0] != "[]  " {
+		t.Errorf("got %q", f.Lines[0])
+	}
+}
+
+func TestLayoutErrors(t *testing.T) {
+	if _, err := (Layout{"{{.Member"}).Render(16, 2, nil); err == nil {
+		t.Error("bad template accepted")
+	}
+	if _, err := (Layout{"{{.Member}}"}).Render(16, 2, 5); err == nil {
+		t.Error("field of an int accepted")
+	}
+}
+
+func TestFrameEqual(t *testing.T) {
+	a := NewFrame(4, 2)
+	b := NewFrame(4, 2)
+	a.Set(0, "hi")
+	if a.Equal(b) || a.Equal(nil) {
+		t.Error("different frames equal")
+	}
+	b.Set(0, "hi")
+	b.Set(5, "off screen")
+	if !a.Equal(b) {
+		t.Error("same frames not equal")
+	}
+}
+
+// The bitmap as text, one character per pixel
+func bitmapArt(buf []byte, width int, height int) string {
+	var s strings.Builder
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if buf[(y/8)*width+x]&(1<<uint(y%8)) != 0 {
+				s.WriteByte('#')
+			} else {
+				s.WriteByte('.')
+			}
+		}
+		s.WriteByte('\n')
+	}
+	return s.String()
+}
+
+func TestBitmapSnapshot(t *testing.T) {
+	f := NewFrame(21, 4)
+	f.Set(0, "goratt frontdoor")
+	f.Set(1, "Hi alice!")
+	f.Set(2, "0123456789 ABC xyz")
+	f.Set(3, "Idle off 4:59")
+	buf := Bitmap(f, 128, 32)
+	if len(buf) != 128*4 {
+		t.Fatalf("bitmap is %d bytes", len(buf))
+	}
+	snapshot(t, "ssd1306-128x32.txt", bitmapArt(buf, 128, 32))
+}
@@ -0,0 +1,109 @@
+package display
+
+import (
+	"os"
+	"time"
+)
+
+// HD44780 character LCD behind a PCF8574 I2C backpack, in 4-bit mode.
+// Backpack pins: P0 RS, P1 RW, P2 E, P3 backlight, P4-P7 D4-D7.
+
+const (
+	lcdRS        = 0x01
+	lcdEnable    = 0x04
+	lcdBacklight = 0x08
+)
+
+var lcdRowAddr = []byte{0x00, 0x40, 0x14, 0x54}
+
+type HD44780 struct {
+	f    *os.File
+	cols int
+	rows int
+	last *Frame
+}
+
+// OpenHD44780 opens e.g. /dev/i2c-1. addr of 0 uses 0x27.
+func OpenHD44780(device string, addr int, cols int, rows int) (*HD44780, error) {
+	if addr == 0 {
+		addr = 0x27
+	}
+	if cols <= 0 {
+		cols = 16
+	}
+	if rows <= 0 || rows > 4 {
+		rows = 2
+	}
+	f, err := openI2C(device, addr)
+	if err != nil {
+		return nil, err
+	}
+	d := &HD44780{f: f, cols: cols, rows: rows}
+
+	// Into 4-bit mode from whatever state it is in
+	time.Sleep(50 * time.Millisecond)
+	for _, n := range []byte{0x03, 0x03, 0x03, 0x02} {
+		if err := d.nibble(n<<4, 0); err != nil {
+			f.Close()
+			return nil, err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, c := range []byte{
+		0x28, // 4-bit, 2 lines, 5x8
+		0x0c, // Display on, no cursor
+		0x01, // Clear
+		0x06, // Left to right
+	} {
+		if err := d.send(c, 0); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+	return d, nil
+}
+
+func (d *HD44780) nibble(n byte, rs byte) error {
+	b := n&0xf0 | rs | lcdBacklight
+	_, err := d.f.Write([]byte{b | lcdEnable, b})
+	return err
+}
+
+func (d *HD44780) send(b byte, rs byte) error {
+	if err := d.nibble(b&0xf0, rs); err != nil {
+		return err
+	}
+	return d.nibble(b<<4, rs)
+}
+
+func (d *HD44780) Size() (int, int) {
+	return d.cols, d.rows
+}
+
+// Show rewrites the rows that changed
+func (d *HD44780) Show(f *Frame) error {
+	for row := 0; row < d.rows && row < f.Rows; row++ {
+		if d.last != nil && d.last.Lines[row] == f.Lines[row] {
+			continue
+		}
+		if err := d.send(0x80|lcdRowAddr[row], 0); err != nil {
+			return err
+		}
+		for _, r := range f.Lines[row] {
+			if r < 0x20 || r > 0x7e {
+				r = '?'
+			}
+			if err := d.send(byte(r), lcdRS); err != nil {
+				return err
+			}
+		}
+	}
+	d.last = f
+	return nil
+}
+
+func (d *HD44780) Close() error {
+	d.send(0x01, 0)
+	return d.f.Close()
+}
@@ -0,0 +1,106 @@
+package display
+
+import (
+	"os"
+)
+
+// SSD1306 128x64 or 128x32 OLED on I2C. Text is 6x8 pixel cells, so 21
+// columns by 8 (or 4) rows.
+
+const (
+	CellWidth  = 6
+	CellHeight = 8
+)
+
+// Bitmap renders a frame for a width x height SSD1306, in its page layout:
+// height/8 pages of width bytes, each byte a column of 8 pixels, bit 0 at
+// the top.
+func Bitmap(f *Frame, width int, height int) []byte {
+	pages := height / 8
+	buf := make([]byte, width*pages)
+	for row, line := range f.Lines {
+		if row >= pages {
+			break
+		}
+		for col, r := range []rune(line) {
+			g := glyph(r)
+			x := col * CellWidth
+			for i, b := range g {
+				if x+i < width {
+					buf[row*width+x+i] = b
+				}
+			}
+		}
+	}
+	return buf
+}
+
+type SSD1306 struct {
+	f      *os.File
+	width  int
+	height int
+}
+
+// OpenSSD1306 opens e.g. /dev/i2c-1. addr of 0 uses 0x3c, height is 64 or 32.
+func OpenSSD1306(device string, addr int, height int) (*SSD1306, error) {
+	if addr == 0 {
+		addr = 0x3c
+	}
+	if height != 32 {
+		height = 64
+	}
+	f, err := openI2C(device, addr)
+	if err != nil {
+		return nil, err
+	}
+	d := &SSD1306{f: f, width: 128, height: height}
+	mux, pins := byte(0x3f), byte(0x12)
+	if height == 32 {
+		mux, pins = 0x1f, 0x02
+	}
+	err = d.command(
+		0xae,       // Display off
+		0xd5, 0x80, // Clock
+		0xa8, mux, // Multiplex
+		0xd3, 0x00, // Offset
+		0x40,       // Start line 0
+		0x8d, 0x14, // Charge pump on
+		0x20, 0x00, // Horizontal addressing
+		0xa1,       // Segment remap
+		0xc8,       // COM scan reversed
+		0xda, pins, // COM pins
+		0x81, 0xcf, // Contrast
+		0xd9, 0xf1, // Precharge
+		0xdb, 0x40, // VCOM detect
+		0xa4, // Show RAM
+		0xa6, // Normal, not inverted
+		0xaf, // Display on
+	)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *SSD1306) command(cmds ...byte) error {
+	_, err := d.f.Write(append([]byte{0x00}, cmds...))
+	return err
+}
+
+func (d *SSD1306) Size() (int, int) {
+	return d.width / CellWidth, d.height / CellHeight
+}
+
+func (d *SSD1306) Show(f *Frame) error {
+	if err := d.command(0x21, 0, byte(d.width-1), 0x22, 0, byte(d.height/8-1)); err != nil {
+		return err
+	}
+	_, err := d.f.Write(append([]byte{0x40}, Bitmap(f, d.width, d.height)...))
+	return err
+}
+
+func (d *SSD1306) Close() error {
+	d.command(0xae)
+	return d.f.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"goratt/display"
+)
+
+func testScreen(t *testing.T) *display.Buffer {
+	b := &display.Buffer{Cols: 16, Rows: 2}
+	screen = b
+	cfg.ClientID = "frontdoor"
+	cfg.Display = &DisplayConfig{ShowSecs: 1}
+	displayLast = nil
+	displayUntil = time.Time{}
+	validTags = []ACLlist{{Member: "alice", Nickname: "Al", Warning: "Dues due Jul 1", Allowed: true}}
+	t.Cleanup(func() {
+		screen = nil
+		cfg.Display = nil
+		validTags = nil
+	})
+	return b
+}
+
+func TestDisplayAccess(t *testing.T) {
+	b := testScreen(t)
+
+	displayAccess(AccessEvent{Allowed: 1, Member: "alice"})
+	if got, want := b.Frame.String(), "Hi Al           \nDues due Jul 1  \n"; got != want {
+		t.Errorf("granted got\n%swant\n%s", got, want)
+	}
+
+	displayAccess(AccessEvent{Allowed: 0, Member: "bob", Reason: "schedule"})
+	if got, want := b.Frame.String(), "Access denied   \nOutside hours   \n"; got != want {
+		t.Errorf("denied got\n%swant\n%s", got, want)
+	}
+
+	// Reasons with no text of their own show as they are
+	displayAccess(AccessEvent{Allowed: 0, Member: "bob", Reason: "limit"})
+	if got := b.Frame.Lines[1]; got != "limit           " {
+		t.Errorf("unknown reason got %q", got)
+	}
+}
+
+func TestDisplayState(t *testing.T) {
+	b := testScreen(t)
+	ledSetOnline(false)
+
+	displayState()
+	if got, want := b.Frame.String(), "frontdoor       \nOFFLINE         \n"; got != want {
+		t.Errorf("offline got\n%swant\n%s", got, want)
+	}
+
+	// An event screen stays up for ShowSecs, then the state comes back
+	displayAccess(AccessEvent{Allowed: 1, Member: "alice"})
+	displayState()
+	if b.Frame.Lines[0] != "Hi Al           " {
+		t.Errorf("event screen replaced early: %q", b.Frame.Lines[0])
+	}
+	displayUntil = time.Now()
+	ledSetOnline(true)
+	displayState()
+	if got, want := b.Frame.String(), "frontdoor       \nBadge in        \n"; got != want {
+		t.Errorf("idle got\n%swant\n%s", got, want)
+	}
+}
+
+func TestDisplayLayoutOverride(t *testing.T) {
+	b := testScreen(t)
+	old := displayLayouts["granted"]
+	defer func() { displayLayouts["granted"] = old }()
+	displayLayouts["granted"] = display.Layout{"Welcome", "{{.Member}}"}
+
+	displayAccess(AccessEvent{Allowed: 1, Member: "alice"})
+	if got, want := b.Frame.String(), "Welcome         \nalice           \n"; got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+package dymo
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Raster protocol for DYMO LabelWriter 400/450 series printers. A job is a
+// few ESC setup commands, one SYN-prefixed line of dots per print head
+// line, and a form feed.
+
+const (
+	ESC = 0x1b
+	SYN = 0x16
+
+	HeadDots = 672 // 300 dpi, 2.24"
+)
+
+// Status byte bits (ESC A)
+var (
+	StatusReady    byte = 0x01
+	StatusPaperOut byte = 0x20
+)
+
+var ErrPaperOut = errors.New("out of labels")
+
+// Media is a label stock. Width is dots across the head, Length is dot
+// lines along the label, DotTab is bytes of head to skip before the label.
+type Media struct {
+	Name   string
+	Width  int
+	Length int
+	DotTab int
+}
+
+// Common stocks, at 300 dpi
+var Labels = map[string]Media{
+	"30252": {Name: "30252 Address", Width: 336, Length: 1050},
+	"99012": {Name: "99012 Large Address", Width: 424, Length: 1050},
+	"30334": {Name: "30334 Multi-Purpose", Width: 672, Length: 378},
+	"30256": {Name: "30256 Shipping", Width: 672, Length: 1200},
+	"11354": {Name: "11354 Multi-Purpose", Width: 672, Length: 378},
+}
+
+func (m Media) BytesPerLine() int {
+	return (m.Width + 7) / 8
+}
+
+func (m Media) check() error {
+	if m.Width <= 0 || m.Length <= 0 {
+		return fmt.Errorf("media %s has no size", m.Name)
+	}
+	if (m.DotTab+m.BytesPerLine())*8 > HeadDots {
+		return fmt.Errorf("media %s is wider than the head", m.Name)
+	}
+	if m.Length > 0xffff {
+		return fmt.Errorf("media %s is too long", m.Name)
+	}
+	return nil
+}
+
+// Is the pixel dark enough to print?
+func dark(img image.Image, x int, y int) bool {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return r+g+b < 3*0x8000
+}
+
+// Encode writes a print job for one label. An image wider than it is tall
+// is turned so its long side runs along the label. Anything past the media
+// size is cut off.
+func Encode(w io.Writer, img image.Image, m Media) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	bounds := img.Bounds()
+	rotate := bounds.Dx() > bounds.Dy()
+	across, along := bounds.Dx(), bounds.Dy()
+	if rotate {
+		across, along = along, across
+	}
+	bpl := m.BytesPerLine()
+
+	job := []byte{
+		ESC, '@', // Reset
+		ESC, 'B', byte(m.DotTab), // Dot tab
+		ESC, 'D', byte(bpl), // Bytes per line
+		ESC, 'L', byte(m.Length >> 8), byte(m.Length), // Label length
+		ESC, 'h', // 300x300 text quality
+	}
+	line := make([]byte, bpl)
+	for l := 0; l < m.Length; l++ {
+		for i := range line {
+			line[i] = 0
+		}
+		if l < along {
+			for d := 0; d < across && d < m.Width; d++ {
+				x, y := d, l
+				if rotate {
+					x, y = l, across-1-d
+				}
+				if dark(img, bounds.Min.X+x, bounds.Min.Y+y) {
+					line[d/8] |= 0x80 >> uint(d%8)
+				}
+			}
+		}
+		job = append(job, SYN)
+		job = append(job, line...)
+	}
+	job = append(job, ESC, 'E') // Form feed to the next label
+	_, err := w.Write(job)
+	return err
+}
+
+// Device is a LabelWriter on /dev/usb/lpN. Reads and writes wait at most
+// Timeout, so a wedged printer returns an error instead of hanging.
+type Device struct {
+	f       *os.File
+	fd      int
+	Timeout time.Duration
+}
+
+var ErrTimeout = errors.New("printer not responding")
+
+func Open(device string) (*Device, error) {
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Device{f: f, fd: int(f.Fd()), Timeout: 10 * time.Second}, nil
+}
+
+// Wait for the printer to be ready to read or write
+func (d *Device) wait(events int16, timeout time.Duration) error {
+	fds := []unix.PollFd{{Fd: int32(d.fd), Events: events}}
+	for {
+		n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrTimeout
+		}
+		if fds[0].Revents&(unix.POLLERR|unix.POLLHUP|unix.POLLNVAL) != 0 {
+			return errors.New("printer gone")
+		}
+		return nil
+	}
+}
+
+// Write in chunks, waiting for the printer before each one
+func (d *Device) Write(p []byte) (int, error) {
+	const chunk = 4096
+	done := 0
+	for done < len(p) {
+		if err := d.wait(unix.POLLOUT, d.Timeout); err != nil {
+			return done, err
+		}
+		end := done + chunk
+		if end > len(p) {
+			end = len(p)
+		}
+		n, err := unix.Write(d.fd, p[done:end])
+		if err == unix.EINTR || err == unix.EAGAIN {
+			continue
+		}
+		if err != nil {
+			return done, err
+		}
+		done += n
+	}
+	return done, nil
+}
+
+func (d *Device) Close() error {
+	return d.f.Close()
+}
+
+// Status asks the printer for its status byte
+func (d *Device) Status() (byte, error) {
+	if _, err := d.Write([]byte{ESC, 'A'}); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 1)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return 0, errors.New("no status from printer")
+		}
+		if err := d.wait(unix.POLLIN, left); err == ErrTimeout {
+			return 0, errors.New("no status from printer")
+		} else if err != nil {
+			return 0, err
+		}
+		n, err := unix.Read(d.fd, buf)
+		if n == 1 {
+			return buf[0], nil
+		}
+		if err != nil && err != unix.EINTR && err != unix.EAGAIN {
+			return 0, err
+		}
+		time.Sleep(50 * time.Millisecond) // Readable but nothing yet
+	}
+}
+
+// Print checks for labels and prints one
+func (d *Device) Print(img image.Image, m Media) error {
+	status, err := d.Status()
+	if err != nil {
+		return err
+	}
+	if status&StatusPaperOut != 0 {
+		return ErrPaperOut
+	}
+	return Encode(d, img, m)
+}
@@ -0,0 +1,125 @@
+package dymo
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// A landscape test label: a border, a diagonal and a solid block in one
+// corner, so rotation and bit order both show up in the stream
+func testLabel(w int, h int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			ink := x < 4 || y < 4 || x >= w-4 || y >= h-4 || x*h/w == y || (x < w/4 && y < h/4)
+			if !ink {
+				img.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	return img
+}
+
+func TestEncodeGolden(t *testing.T) {
+	for name, m := range Labels {
+		var buf bytes.Buffer
+		if err := Encode(&buf, testLabel(m.Length, m.Width), m); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		golden := filepath.Join("testdata", name+".bin")
+		if *update {
+			if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("%s: %v (run with -update to create)", name, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: job differs from %s", name, golden)
+		}
+	}
+}
+
+func TestEncodeLayout(t *testing.T) {
+	m := Media{Name: "test", Width: 16, Length: 3, DotTab: 2}
+	// All black and landscape, so it's turned: 2 dots across, cut to 3 lines
+	img := image.NewGray(image.Rect(0, 0, 16, 2))
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, m); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		ESC, '@',
+		ESC, 'B', 2,
+		ESC, 'D', 2,
+		ESC, 'L', 0, 3,
+		ESC, 'h',
+		SYN, 0xc0, 0x00,
+		SYN, 0xc0, 0x00,
+		SYN, 0xc0, 0x00,
+		ESC, 'E',
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got % x\nwant % x", buf.Bytes(), want)
+	}
+}
+
+func TestMediaCheck(t *testing.T) {
+	if err := Encode(ioutil.Discard, testLabel(10, 10), Media{Name: "wide", Width: 680, Length: 10}); err == nil {
+		t.Error("media wider than the head accepted")
+	}
+	if err := Encode(ioutil.Discard, testLabel(10, 10), Media{Name: "empty"}); err == nil {
+		t.Error("media with no size accepted")
+	}
+}
+
+// A device on one end of a socket pair, with the test as the printer
+func testDevice(t *testing.T) (*Device, int) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "printer")
+	t.Cleanup(func() {
+		f.Close()
+		unix.Close(fds[1])
+	})
+	return &Device{f: f, fd: fds[0], Timeout: time.Second}, fds[1]
+}
+
+func TestStatus(t *testing.T) {
+	d, printer := testDevice(t)
+	go func() {
+		cmd := make([]byte, 2)
+		unix.Read(printer, cmd)
+		unix.Write(printer, []byte{StatusReady | StatusPaperOut})
+	}()
+	if err := d.Print(testLabel(10, 10), Labels["30252"]); err != ErrPaperOut {
+		t.Errorf("got %v, want ErrPaperOut", err)
+	}
+}
+
+func TestStatusTimeout(t *testing.T) {
+	d, _ := testDevice(t)
+	start := time.Now()
+	if _, err := d.Status(); err == nil {
+		t.Fatal("status with no printer answering")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("status took %v", time.Since(start))
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tag capture. In enrollment mode the next unknown credential is published
+// on the enroll topic so the backend can assign it. Outside enrollment mode
+// unknown tags are still published, rate-limited, on the unknowntag topic.
+
+// Unknown credential - off the wire
+type TagEvent struct {
+	Tag       uint64 `json:"tag"`
+	Hex       string `json:"hex"`
+	Tag10h    string `json:"10h"`
+	Facility  uint64 `json:"facility"`
+	Card      uint64 `json:"card"`
+	Reader    string `json:"reader,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+type EnrollRequest struct {
+	Enable bool `json:"enable"`
+}
+
+var enrollMutex sync.Mutex
+var enrollUntil time.Time
+var enrollTimer *time.Timer
+var lastUnknownPublish time.Time
+
+// First swipe of an enroll badge, waiting to see if a second one follows
+type enrollSwipe struct {
+	reader *ReaderConfig
+	member string
+	at     time.Time // When the first swipe was handled
+}
+
+var firstEnrollSwipe *enrollSwipe
+
+func enrollDuration() time.Duration {
+	if cfg.EnrollSecs > 0 {
+		return time.Duration(cfg.EnrollSecs) * time.Second
+	}
+	return 60 * time.Second
+}
+
+func enrollSwipeWindow() time.Duration {
+	if cfg.EnrollSwipeSecs > 0 {
+		return time.Duration(cfg.EnrollSwipeSecs) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// Admin badge that can enter (or leave) enrollment mode
+func isEnrollBadge(tag ACLlist) bool {
+	return cfg.EnrollLevel != nil && tag.Allowed && tag.Level >= *cfg.EnrollLevel
+}
+
+func enrollActive() bool {
+	enrollMutex.Lock()
+	defer enrollMutex.Unlock()
+	return time.Now().Before(enrollUntil)
+}
+
+func setEnroll(on bool, who string) {
+	enrollMutex.Lock()
+	if enrollTimer != nil {
+		enrollTimer.Stop()
+		enrollTimer = nil
+	}
+	if on {
+		enrollUntil = time.Now().Add(enrollDuration())
+		enrollTimer = time.AfterFunc(enrollDuration(), func() {
+			fmt.Println("Enrollment mode timed out")
+			ledRefresh()
+		})
+	} else {
+		enrollUntil = time.Time{}
+	}
+	enrollMutex.Unlock()
+
+	if on {
+		fmt.Printf("Enrollment mode on (%s)\n", who)
+	} else {
+		fmt.Printf("Enrollment mode off (%s)\n", who)
+	}
+	ledRefresh()
+}
+
+// Enroll badge swiped. A single swipe is a normal grant, and returns
+// false. Swiping again on the same reader within EnrollSwipeSecs of the
+// first being handled turns enrollment mode on. While enrolling, one swipe
+// turns it off.
+func EnrollBadge(r *ReaderConfig, tag ACLlist) bool {
+	if enrollActive() {
+		setEnroll(false, tag.Member)
+		return true
+	}
+	enrollMutex.Lock()
+	w := firstEnrollSwipe
+	second := w != nil && w.reader == r && w.member == tag.Member && !w.at.IsZero() && time.Since(w.at) < enrollSwipeWindow()
+	if second {
+		firstEnrollSwipe = nil
+	} else {
+		firstEnrollSwipe = &enrollSwipe{reader: r, member: tag.Member}
+	}
+	enrollMutex.Unlock()
+
+	if second {
+		setEnroll(true, tag.Member)
+	}
+	return second
+}
+
+// The first enroll badge swipe has been handled (the door is closed
+// again) - start the window for the second
+func enrollSwipeHandled(r *ReaderConfig, tag ACLlist) {
+	enrollMutex.Lock()
+	defer enrollMutex.Unlock()
+	if w := firstEnrollSwipe; w != nil && w.reader == r && w.member == tag.Member && w.at.IsZero() {
+		w.at = time.Now()
+	}
+}
+
+// Remote enroll command
+func EnrollCommand(payload []byte) {
+	var request EnrollRequest
+	err := json.Unmarshal(payload, &request)
+	if err != nil {
+		fmt.Println("Error decoding JSON:", err)
+		return
+	}
+	setEnroll(request.Enable, "remote")
+}
+
+// All the ways backends and readers write the same credential
+func newTagEvent(r *ReaderConfig, id uint64) TagEvent {
+	ev := TagEvent{
+		Tag:      id,
+		Hex:      fmt.Sprintf("%x", id),
+		Tag10h:   fmt.Sprintf("%010x", id),
+		Facility: (id >> 16) & 0xff,
+		Card:     id & 0xffff,
+	}
+	if r != nil {
+		ev.Reader = r.Name
+		ev.Direction = r.Direction
+	}
+	return ev
+}
+
+// A tag not in the ACL. Returns true if it was captured for enrollment.
+func UnknownTag(r *ReaderConfig, id uint64) bool {
+	ev := newTagEvent(r, id)
+	message, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Println("Error encoding tag event:", err)
+		return false
+	}
+
+	enrollMutex.Lock()
+	enrolling := time.Now().Before(enrollUntil)
+	if enrolling {
+		enrollUntil = time.Time{}
+		if enrollTimer != nil {
+			enrollTimer.Stop()
+			enrollTimer = nil
+		}
+	}
+	limit := time.Duration(cfg.UnknownTagSecs) * time.Second
+	if limit == 0 {
+		limit = 10 * time.Second
+	}
+	publish := enrolling || time.Since(lastUnknownPublish) >= limit
+	if publish && !enrolling {
+		lastUnknownPublish = time.Now()
+	}
+	enrollMutex.Unlock()
+
+	if enrolling {
+		fmt.Println("Enrolled tag", id)
+		var topic string = fmt.Sprintf("ratt/status/node/%s/enroll", cfg.ClientID)
+		client.Publish(topic, 0, false, message)
+		ledShow("granted", time.Second)
+		return true
+	}
+	if publish {
+		var topic string = fmt.Sprintf("ratt/status/node/%s/unknowntag", cfg.ClientID)
+		client.Publish(topic, 0, false, message)
+	} else {
+		debugf("Unknown tag %d not published (rate limit)\n", id)
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// Declarative description of a serial reader's frame, so a new reader is
+// a config change. Byte positions are offsets from the start of the frame
+// (the first preamble byte). Ranges are [Start, End).
+type FrameSpec struct {
+	Baud       int    `yaml:"Baud"`
+	Preamble   string `yaml:"Preamble"`   // Hex, e.g. "0209"
+	Length     int    `yaml:"Length"`     // Fixed frame length, or 0 to read to Terminator
+	Terminator string `yaml:"Terminator"` // Hex, e.g. "03"
+
+	Checksum      string `yaml:"Checksum"` // "xor", "sum", "crc16" or "none"
+	ChecksumStart int    `yaml:"ChecksumStart"`
+	ChecksumEnd   int    `yaml:"ChecksumEnd"`
+	ChecksumPos   int    `yaml:"ChecksumPos"`
+
+	IDStart  int    `yaml:"IDStart"`
+	IDEnd    int    `yaml:"IDEnd"`
+	Encoding string `yaml:"Encoding"` // "binary" or "ascii-hex"
+
+	preamble   []byte
+	terminator []byte
+}
+
+// The original USB reader: 02 09 .. .. id id id id xor 03 at 115200
+var defaultFrameSpec = FrameSpec{
+	Baud:          115200,
+	Preamble:      "0209",
+	Length:        9,
+	Terminator:    "03",
+	Checksum:      "xor",
+	ChecksumStart: 1,
+	ChecksumEnd:   7,
+	ChecksumPos:   7,
+	IDStart:       3,
+	IDEnd:         7,
+	Encoding:      "binary",
+}
+
+// Longest frame we will buffer while looking for a terminator
+const maxFrameLength = 64
+
+// Parse the hex fields and sanity check the ranges
+func (s *FrameSpec) init() error {
+	var err error
+	if s.Baud == 0 {
+		s.Baud = 9600
+	}
+	if s.preamble, err = hex.DecodeString(s.Preamble); err != nil {
+		return fmt.Errorf("bad Preamble %q: %w", s.Preamble, err)
+	}
+	if len(s.preamble) == 0 {
+		return fmt.Errorf("Preamble is required")
+	}
+	if s.terminator, err = hex.DecodeString(s.Terminator); err != nil {
+		return fmt.Errorf("bad Terminator %q: %w", s.Terminator, err)
+	}
+	if s.Length == 0 && len(s.terminator) == 0 {
+		return fmt.Errorf("one of Length or Terminator is required")
+	}
+	if s.Length > maxFrameLength {
+		return fmt.Errorf("Length %d is over %d", s.Length, maxFrameLength)
+	}
+	if s.IDEnd <= s.IDStart {
+		return fmt.Errorf("bad ID range %d-%d", s.IDStart, s.IDEnd)
+	}
+	if s.Encoding == "" {
+		s.Encoding = "binary"
+	}
+	if s.Encoding != "binary" && s.Encoding != "ascii-hex" {
+		return fmt.Errorf("unknown Encoding %q", s.Encoding)
+	}
+	if s.Checksum == "" {
+		s.Checksum = "none"
+	}
+	switch s.Checksum {
+	case "none":
+	case "xor", "sum", "crc16":
+		if s.ChecksumEnd <= s.ChecksumStart {
+			return fmt.Errorf("bad checksum range %d-%d", s.ChecksumStart, s.ChecksumEnd)
+		}
+	default:
+		return fmt.Errorf("unknown Checksum %q", s.Checksum)
+	}
+	return nil
+}
+
+// Pull the next complete frame off the front of buf. Returns the frame (nil
+// if there isn't a whole one yet) and what is left of the buffer. Noise
+// before the preamble is dropped.
+func (s *FrameSpec) nextFrame(buf []byte) (frame []byte, rest []byte) {
+	i := bytes.Index(buf, s.preamble)
+	if i < 0 {
+		// Keep a possible partial preamble at the end
+		keep := len(s.preamble) - 1
+		if len(buf) > keep {
+			buf = buf[len(buf)-keep:]
+		}
+		return nil, buf
+	}
+	buf = buf[i:]
+
+	if s.Length > 0 {
+		if len(buf) < s.Length {
+			return nil, buf
+		}
+		return buf[:s.Length], buf[s.Length:]
+	}
+
+	j := bytes.Index(buf[len(s.preamble):], s.terminator)
+	if j < 0 {
+		if len(buf) >= maxFrameLength {
+			// Never going to see a terminator - resync on the next preamble
+			return nil, buf[len(s.preamble):]
+		}
+		return nil, buf
+	}
+	end := len(s.preamble) + j + len(s.terminator)
+	if end > maxFrameLength {
+		// Too long to be a frame - resync on the next preamble
+		return nil, buf[len(s.preamble):]
+	}
+	return buf[:end], buf[end:]
+}
+
+// The bytes of a field, decoding ASCII hex if that is the encoding
+func (s *FrameSpec) field(frame []byte, start int, end int) ([]byte, error) {
+	if start < 0 || end > len(frame) || end <= start {
+		return nil, fmt.Errorf("range %d-%d outside %d byte frame", start, end, len(frame))
+	}
+	if s.Encoding == "ascii-hex" {
+		return hex.DecodeString(string(frame[start:end]))
+	}
+	return frame[start:end], nil
+}
+
+// Check a complete frame and return the tag number in it
+func (s *FrameSpec) decodeFrame(frame []byte) (uint64, error) {
+	if !bytes.HasPrefix(frame, s.preamble) {
+		return 0, fmt.Errorf("bad preamble % x", frame)
+	}
+	if s.Length > 0 && len(s.terminator) > 0 && !bytes.HasSuffix(frame, s.terminator) {
+		return 0, fmt.Errorf("bad terminator % x", frame)
+	}
+
+	if s.Checksum != "none" {
+		data, err := s.field(frame, s.ChecksumStart, s.ChecksumEnd)
+		if err != nil {
+			return 0, fmt.Errorf("checksum data: %w", err)
+		}
+		width := 1
+		if s.Checksum == "crc16" {
+			width = 2
+		}
+		if s.Encoding == "ascii-hex" {
+			width *= 2
+		}
+		got, err := s.field(frame, s.ChecksumPos, s.ChecksumPos+width)
+		if err != nil {
+			return 0, fmt.Errorf("checksum: %w", err)
+		}
+		want := frameChecksum(s.Checksum, data)
+		if !bytes.Equal(got, want) {
+			return 0, fmt.Errorf("bad checksum % x expected % x", got, want)
+		}
+	}
+
+	id, err := s.field(frame, s.IDStart, s.IDEnd)
+	if err != nil {
+		return 0, fmt.Errorf("id: %w", err)
+	}
+	if len(id) > 8 {
+		return 0, fmt.Errorf("id too long: %d bytes", len(id))
+	}
+	var tagno uint64
+	for _, b := range id {
+		tagno = (tagno << 8) | uint64(b)
+	}
+	return tagno, nil
+}
+
+// Checksum bytes as they appear (decoded) in the frame. CRC16 is
+// CRC-16/MODBUS, low byte first.
+func frameChecksum(algo string, data []byte) []byte {
+	switch algo {
+	case "xor":
+		var x byte
+		for _, b := range data {
+			x ^= b
+		}
+		return []byte{x}
+	case "sum":
+		var sum byte
+		for _, b := range data {
+			sum += b
+		}
+		return []byte{sum}
+	case "crc16":
+		crc := uint16(0xffff)
+		for _, b := range data {
+			crc ^= uint16(b)
+			for i := 0; i < 8; i++ {
+				if crc&1 != 0 {
+					crc = (crc >> 1) ^ 0xa001
+				} else {
+					crc >>= 1
+				}
+			}
+		}
+		return []byte{byte(crc), byte(crc >> 8)}
+	}
+	return nil
+}
+
+func (s *FrameSpec) String() string {
+	return fmt.Sprintf("%d baud preamble %s terminator %s length %d checksum %s id %d-%d %s",
+		s.Baud, s.Preamble, s.Terminator, s.Length, s.Checksum, s.IDStart, s.IDEnd, s.Encoding)
+}
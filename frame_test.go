@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func testSpec(t *testing.T, s FrameSpec) *FrameSpec {
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+	return &s
+}
+
+// How readrfid decoded a 9 byte frame before FrameSpec
+func oldReadrfid(buff []byte) uint64 {
+	if !bytes.Equal(buff[0:2], []byte{0x02, 0x09}) || buff[8] != 0x03 {
+		return 0
+	}
+	data := buff[1:7]
+	xor := data[0]
+	for i := 1; i < len(data); i++ {
+		xor ^= data[i]
+	}
+	tagno := (uint64(data[2]) << 24) | (uint64(data[3]) << 16) | (uint64(data[4]) << 8) | uint64(data[5])
+	if xor != buff[7] {
+		return 0
+	}
+	return tagno
+}
+
+func TestFrameChecksum(t *testing.T) {
+	check := []byte("123456789")
+	tests := []struct {
+		algo string
+		data []byte
+		want string
+	}{
+		{"xor", []byte{0x09, 0x00, 0x12, 0x34, 0x56, 0x78}, "01"},
+		{"sum", []byte{0x01, 0x02, 0x03}, "06"},
+		{"sum", []byte{0xff, 0x02}, "01"}, // Wraps
+		{"crc16", check, "374b"},          // CRC-16/MODBUS check value 0x4b37, low byte first
+		{"crc16", []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, "840a"},
+		{"none", check, ""},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(frameChecksum(tt.algo, tt.data)); got != tt.want {
+			t.Errorf("%s % x: got %s, want %s", tt.algo, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeDefaultFrame(t *testing.T) {
+	s := testSpec(t, defaultFrameSpec)
+	frames := []string{
+		"0209001234567801" + "03",
+		"0209aadeadbeef" + "81" + "03",
+		"0209000000000009" + "03",
+		"02090012345678" + "02" + "03", // Bad xor
+		"0208001234567801" + "03",      // Bad preamble
+		"0209001234567801" + "04",      // Bad terminator
+	}
+	for _, f := range frames {
+		frame, _ := hex.DecodeString(f)
+		want := oldReadrfid(frame)
+		got, err := s.decodeFrame(frame)
+		if err != nil && want != 0 {
+			t.Errorf("%s: %v, readrfid got %d", f, err, want)
+		}
+		if err == nil && got != want {
+			t.Errorf("%s: got %d, readrfid got %d", f, got, want)
+		}
+	}
+	frame, _ := hex.DecodeString("020900123456780103")
+	if got, _ := s.decodeFrame(frame); got != 0x12345678 {
+		t.Errorf("got %x", got)
+	}
+}
+
+func TestDecodeFrames(t *testing.T) {
+	asciiHex := FrameSpec{
+		Preamble: "02", Terminator: "03",
+		Checksum: "xor", ChecksumStart: 1, ChecksumEnd: 11, ChecksumPos: 11,
+		IDStart: 1, IDEnd: 11, Encoding: "ascii-hex",
+	}
+	sum := FrameSpec{
+		Preamble: "aa", Length: 7,
+		Checksum: "sum", ChecksumStart: 1, ChecksumEnd: 5, ChecksumPos: 5,
+		IDStart: 1, IDEnd: 5, Terminator: "bb",
+	}
+	crc := FrameSpec{
+		Preamble: "aa55", Length: 8,
+		Checksum: "crc16", ChecksumStart: 2, ChecksumEnd: 6, ChecksumPos: 6,
+		IDStart: 2, IDEnd: 6,
+	}
+	tests := []struct {
+		name  string
+		spec  FrameSpec
+		frame []byte
+		want  uint64
+		ok    bool
+	}{
+		{"ascii-hex", asciiHex, []byte("\x02010203040501\x03"), 0x0102030405, true},
+		{"ascii-hex lower case", asciiHex, []byte("\x020a0b0c0d0e0f\x03"), 0x0a0b0c0d0e, false}, // xor is 0e
+		{"ascii-hex lower ok", asciiHex, []byte("\x020a0b0c0d0e0e\x03"), 0x0a0b0c0d0e, true},
+		{"ascii-hex bad checksum", asciiHex, []byte("\x020102030405FF\x03"), 0, false},
+		{"ascii-hex not hex", asciiHex, []byte("\x020102030G050F\x03"), 0, false},
+		{"sum", sum, []byte{0xaa, 0x01, 0x02, 0x03, 0xff, 0x05, 0xbb}, 0x010203ff, true},
+		{"sum bad checksum", sum, []byte{0xaa, 0x01, 0x02, 0x03, 0xff, 0x06, 0xbb}, 0, false},
+		{"sum bad terminator", sum, []byte{0xaa, 0x01, 0x02, 0x03, 0xff, 0x05, 0xbc}, 0, false},
+		{"crc16", crc, []byte{0xaa, 0x55, 0x12, 0x34, 0x56, 0x78, 0x7b, 0x10}, 0x12345678, true},
+		{"crc16 swapped", crc, []byte{0xaa, 0x55, 0x12, 0x34, 0x56, 0x78, 0x10, 0x7b}, 0, false},
+	}
+	for _, tt := range tests {
+		s := testSpec(t, tt.spec)
+		got, err := s.decodeFrame(tt.frame)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v", tt.name, err)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("%s: got %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNextFrame(t *testing.T) {
+	fixed := testSpec(t, defaultFrameSpec)
+	good, _ := hex.DecodeString("020900123456780103")
+
+	// Garbage, including a stray 02 and a partial preamble, before a frame
+	buf := append([]byte{0xff, 0x02, 0x00, 0x13, 0x02}, good...)
+	buf = append(buf, 0x02) // Start of the next one
+	frame, rest := fixed.nextFrame(buf)
+	if !bytes.Equal(frame, good) {
+		t.Fatalf("got % x", frame)
+	}
+	if !bytes.Equal(rest, []byte{0x02}) {
+		t.Errorf("rest % x", rest)
+	}
+
+	// Half a frame waits for the rest
+	frame, rest = fixed.nextFrame(good[:5])
+	if frame != nil || !bytes.Equal(rest, good[:5]) {
+		t.Errorf("partial got % x, rest % x", frame, rest)
+	}
+
+	// No preamble - keep only what could be the start of one
+	frame, rest = fixed.nextFrame([]byte{0x11, 0x22, 0x02})
+	if frame != nil || !bytes.Equal(rest, []byte{0x02}) {
+		t.Errorf("noise got % x, rest % x", frame, rest)
+	}
+
+	// Terminated frames, resyncing after a run with no terminator
+	term := testSpec(t, FrameSpec{Preamble: "02", Terminator: "0d0a", IDStart: 1, IDEnd: 5, Encoding: "ascii-hex"})
+	frame, rest = term.nextFrame([]byte("xx\x02ABCD\r\n\x021234"))
+	if string(frame) != "\x02ABCD\r\n" || string(rest) != "\x021234" {
+		t.Errorf("terminated got %q, rest %q", frame, rest)
+	}
+	runaway := append([]byte{0x02}, bytes.Repeat([]byte{'A'}, maxFrameLength)...)
+	runaway = append(runaway, []byte("\x02BEEF\r\n")...)
+	for i := 0; i < 3; i++ {
+		if frame, runaway = term.nextFrame(runaway); frame != nil {
+			break
+		}
+	}
+	if string(frame) != "\x02BEEF\r\n" {
+		t.Errorf("no resync after runaway frame, got %q", frame)
+	}
+	if id, err := term.decodeFrame(frame); err != nil || id != 0xbeef {
+		t.Errorf("decoded %x, %v", id, err)
+	}
+}
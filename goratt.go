@@ -23,20 +23,24 @@ import (
 
 	"encoding/base64"
 	"net/http"
+	"net/url"
 
 	//"github.com/tarm/serial"
-	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/binary"
 	"encoding/hex"
-	"github.com/kenshaw/evdev"
 	"goratt/wiegland"
 )
 
 var client mqtt.Client
 var myOpenTopic string
+var myEnrollTopic string
+var myUnlockTopic string
+var myPassbackTopic string
+var myEstopResetTopic string
+var myPassCloseTopic string
 var myBuild string
 
 type RattConfig struct {
@@ -55,44 +59,107 @@ type RattConfig struct {
 	OpenSecret   string `yaml:"OpenSecret"`
 	OpenToolName string `yaml:"OpenToolName"`
 
-	TagFile    string `yaml:"TagFile"`
-	ServoClose int    `yaml:"ServoClose"`
-	ServoOpen  int    `yaml:"ServoOpen"`
-	WaitSecs   int    `yaml:"WaitSecs"`
+	TagFile     string             `yaml:"TagFile"`
+	ServoClose  int                `yaml:"ServoClose"`
+	ServoOpen   int                `yaml:"ServoOpen"`
+	ServoMotion *ServoMotionConfig `yaml:"ServoMotion"`
+	WaitSecs    int                `yaml:"WaitSecs"`
+
+	MaxOpenSecs   int    `yaml:"MaxOpenSecs"`
+	OpenTimesFile string `yaml:"OpenTimesFile"`
+	OverrideFile  string `yaml:"OverrideFile"`
 
 	NFCdevice string `yaml:"NFCdevice"`
 	NFCmode   string `yaml:"NFCmode"`
 
-	DoorPin *int   `yaml:"DoorPin"`
-	LEDpipe string `yaml:"LEDpipe"`
+	DoorPin     *int              `yaml:"DoorPin"`
+	LEDpipe     string            `yaml:"LEDpipe"`
+	LEDPatterns map[string]string `yaml:"LEDPatterns"` // Event/state name -> pattern
+	LEDStrip    *LEDStripConfig   `yaml:"LEDStrip"`
+
+	Display *DisplayConfig `yaml:"Display"`
+	Sound   *SoundConfig   `yaml:"Sound"`
 
 	GreenLED  *uint8 `yaml:"GreenLED"`
 	YellowLED *uint8 `yaml:"YellowLED"`
 	RedLED    *uint8 `yaml:"RedLED"`
+
+	PinRequired    bool   `yaml:"PinRequired"`
+	PinDevice      string `yaml:"PinDevice"`
+	PinTimeout     int    `yaml:"PinTimeout"`
+	PinMaxAttempts int    `yaml:"PinMaxAttempts"`
+	PinLockoutSecs int    `yaml:"PinLockoutSecs"`
+
+	Readers      []ReaderConfig `yaml:"Readers"`
+	DebounceSecs int            `yaml:"DebounceSecs"`
+	Debug        bool           `yaml:"Debug"`
+
+	SerialFrame *FrameSpec `yaml:"SerialFrame"`
+
+	EnrollLevel     *int `yaml:"EnrollLevel"`
+	EnrollSecs      int  `yaml:"EnrollSecs"`
+	EnrollSwipeSecs int  `yaml:"EnrollSwipeSecs"`
+	UnknownTagSecs  int  `yaml:"UnknownTagSecs"`
+
+	AccessSchedules *ScheduleConfig  `yaml:"AccessSchedules"`
+	UnlockSchedules []UnlockSchedule `yaml:"UnlockSchedules"`
+	StateFile       string           `yaml:"StateFile"`
+
+	Lockout      *LockoutConfig  `yaml:"Lockout"`
+	AntiPassback *PassbackConfig `yaml:"AntiPassback"`
+
+	TwoPersonSecs int  `yaml:"TwoPersonSecs"`
+	TrainerLevel  *int `yaml:"TrainerLevel"`
+	TrainerSecs   int  `yaml:"TrainerSecs"`
+
+	Personality string      `yaml:"Personality"`
+	Tool        *ToolConfig `yaml:"Tool"`
+
+	Safety *SafetyConfig `yaml:"Safety"`
+
+	StoragePass *StoragePassConfig `yaml:"StoragePass"`
+}
+
+// One badge reader. With no Readers configured, NFCdevice/NFCmode and
+// DoorPin/Mode make up a single default reader.
+type ReaderConfig struct {
+	Name      string `yaml:"Name"`
+	Mode      string `yaml:"Mode"`
+	Device    string `yaml:"Device"`
+	Direction string `yaml:"Direction"` // "in", "out" or unset
+	DoorPin   *int   `yaml:"DoorPin"`
+	DoorMode  string `yaml:"DoorMode"`
+
+	DebounceSecs int        `yaml:"DebounceSecs"`
+	SerialFrame  *FrameSpec `yaml:"SerialFrame"`
+	PinDevice    string     `yaml:"PinDevice"` // Keypad for PINs at this reader
+
+	pinFor *ReaderConfig // A PinDevice's keypad - the reader it types into
+
+	// Duplicate suppression state
+	seenMutex sync.Mutex
+	lastTag   uint64
+	lastSeen  time.Time
 }
 
 // In-memory ACL list
 type ACLlist struct {
-	Tag     uint64
-	Level   int
-	Member  string
-	Allowed bool
+	Tag      uint64
+	Level    int
+	Member   string
+	Allowed  bool
+	PinHash  string
+	OpenSecs int    // Door open time, 0 for WaitSecs
+	Override string // "allow" or "deny" if from the local override file
+	Nickname string
+	Warning  string // Shown to the member, e.g. membership lapsing
+	trainer  string // Trainer who let this unauthorized member in
 }
 
 var validTags []ACLlist
 
-var LEDfile *os.File
-var LEDidleString string
 var cfg RattConfig
 
-const (
-	LEDconnectionLost = "@2 !150000 001010"
-	LEDnormalIdle     = "@3 !150000 400000"
-	LEDaccessGranted  = "@1 !50000 8000"
-	LEDaccessDenied   = "@2 !10000 ff"
-	LEDterminated     = "@0 010101"
-)
-
 // From API - off the wire
 type ACLentry struct {
 	Tagid         string `json:"tagid"`
@@ -105,6 +172,8 @@ type ACLentry struct {
 	Last_accessed string `json:"last_accessed"`
 	Level         int    `json:"level"`
 	Raw_tag_id    string `json:"raw_tag_id"`
+	Pin_hash      string `json:"pin_hash"`
+	Open_secs     int    `json:"open_secs"`
 }
 
 type OpenRequest struct {
@@ -116,13 +185,10 @@ type OpenRequest struct {
 
 var aclfileMutex sync.Mutex
 
-func LEDupdateIdleString(str string) {
-	LEDidleString = str
-}
-
-func LEDwriteString(str string) {
-	if LEDfile != nil {
-		LEDfile.Write([]byte(str))
+// Only printed with Debug set in the config
+func debugf(format string, a ...interface{}) {
+	if cfg.Debug {
+		fmt.Printf("[DEBUG] "+format, a...)
 	}
 }
 
@@ -200,17 +266,26 @@ func GetACLList() {
 		number, err := strconv.ParseUint(item.Raw_tag_id, 10, 64)
 		if err == nil {
 			validTags = append(validTags, ACLlist{
-				Tag:     number,
-				Level:   item.Level,
-				Member:  item.Member,
-				Allowed: (item.Allowed == "allowed"),
+				Tag:      number,
+				Level:    item.Level,
+				Member:   item.Member,
+				Allowed:  (item.Allowed == "allowed"),
+				PinHash:  item.Pin_hash,
+				OpenSecs: item.Open_secs,
+				Nickname: item.Nickname,
+				Warning:  item.Warning,
 			})
 		}
 		access := "denied"
 		if item.Allowed == "allowed" {
 			access = "allowed"
 		}
-		_, err = file.WriteString(fmt.Sprintf("%d %s %d %s\n", number, access, item.Level, item.Member))
+		pinhash := "-"
+		if item.Pin_hash != "" {
+			pinhash = item.Pin_hash
+		}
+		_, err = file.WriteString(fmt.Sprintf("%d %s %d %s %s %d %s %s\n", number, access, item.Level, item.Member, pinhash, item.Open_secs,
+			tagFileText(item.Nickname), tagFileText(item.Warning)))
 		if err != nil {
 			fmt.Println("Error writing to tag file: ", err)
 			file.Close()
@@ -235,6 +310,25 @@ func GetACLList() {
 
 }
 
+// Free text (nickname, warning) as one tag file column
+func tagFileText(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return url.PathEscape(s)
+}
+
+func tagFileUnText(s string) string {
+	if s == "-" {
+		return ""
+	}
+	u, err := url.PathUnescape(s)
+	if err != nil {
+		return s
+	}
+	return u
+}
+
 func ReadTagFile() {
 	aclfileMutex.Lock()
 	defer aclfileMutex.Unlock()
@@ -254,17 +348,33 @@ func ReadTagFile() {
 	var level int
 	var member string
 	var access string
+	var pinhash string
+	var opensecs int
+	var nickname string
+	var warning string
 
 	validTags = validTags[:0]
 	for scanner.Scan() {
 		line := scanner.Text()
-		_, err := fmt.Sscanf(line, "%d %s %d %s", &tag, &access, &level, &member)
-		if err == nil {
+		pinhash = "-"
+		opensecs = 0
+		nickname = "-"
+		warning = "-"
+		// Older tag files have no PIN hash, open time, nickname or warning columns
+		n, _ := fmt.Sscanf(line, "%d %s %d %s %s %d %s %s", &tag, &access, &level, &member, &pinhash, &opensecs, &nickname, &warning)
+		if n >= 4 {
+			if pinhash == "-" {
+				pinhash = ""
+			}
 			validTags = append(validTags, ACLlist{
-				Tag:     tag,
-				Level:   level,
-				Member:  member,
-				Allowed: (access == "allowed"),
+				Tag:      tag,
+				Level:    level,
+				Member:   member,
+				Allowed:  (access == "allowed"),
+				PinHash:  pinhash,
+				OpenSecs: opensecs,
+				Nickname: tagFileUnText(nickname),
+				Warning:  tagFileUnText(warning),
 			})
 		}
 	}
@@ -282,9 +392,28 @@ func onConnectHandler(client mqtt.Client) {
 	if token := client.Subscribe(myOpenTopic, 0, nil); token.Wait() && token.Error() != nil {
 		log.Fatal("MQTT Subscribe error: ", token.Error())
 	}
+
+	if token := client.Subscribe(myEnrollTopic, 0, nil); token.Wait() && token.Error() != nil {
+		log.Fatal("MQTT Subscribe error: ", token.Error())
+	}
+
+	if token := client.Subscribe(myUnlockTopic, 0, nil); token.Wait() && token.Error() != nil {
+		log.Fatal("MQTT Subscribe error: ", token.Error())
+	}
+
+	if token := client.Subscribe(myPassbackTopic, 0, nil); token.Wait() && token.Error() != nil {
+		log.Fatal("MQTT Subscribe error: ", token.Error())
+	}
+
+	if token := client.Subscribe(myEstopResetTopic, 0, nil); token.Wait() && token.Error() != nil {
+		log.Fatal("MQTT Subscribe error: ", token.Error())
+	}
+
+	if token := client.Subscribe(myPassCloseTopic, 0, nil); token.Wait() && token.Error() != nil {
+		log.Fatal("MQTT Subscribe error: ", token.Error())
+	}
 	// Slow Blue Pulse
-	LEDupdateIdleString(LEDnormalIdle)
-	LEDwriteString(LEDnormalIdle)
+	ledSetOnline(true)
 
 }
 
@@ -293,8 +422,7 @@ func onConnectionLost(client mqtt.Client, err error) {
 	// panic(fmt.Errorf("MQTT CONNECTION LOST: %s",err))
 	fmt.Printf("MQTT CONNECTION LOST: %s", err)
 	// Slow Yellow Wink
-	LEDupdateIdleString(LEDconnectionLost)
-	LEDwriteString(LEDconnectionLost)
+	ledSetOnline(false)
 }
 
 // SignRequest computes an HMAC-SHA256 over (member || timestampBE)
@@ -352,6 +480,28 @@ func VerifyOpenRequestSignature(base64Secret string, member string, tool string,
 	return fmt.Errorf("Signature verification failed")
 }
 
+// Signature, tool name and timestamp checks for signed remote requests
+func VerifyRemoteRequest(request OpenRequest, toolName string) error {
+	err := VerifyOpenRequestSignature(cfg.OpenSecret, request.Member, request.ToolName, request.Timestamp, request.Signature)
+	if err != nil {
+		return err
+	}
+
+	if toolName != request.ToolName {
+		return fmt.Errorf("Wrong toolname \"%s\" - expected \"%s\"", request.ToolName, toolName)
+	}
+
+	timestamp := time.Unix(int64(request.Timestamp), 0) // seconds + 0 nanos
+	windowStart := timestamp.Add(-5 * time.Minute)
+	windowEnd := timestamp.Add(5 * time.Minute)
+	now := time.Now()
+
+	if now.Before(windowStart) || now.After(windowEnd) {
+		return fmt.Errorf("Request timeout")
+	}
+	return nil
+}
+
 func onMessageReceived(client mqtt.Client, message mqtt.Message) {
 	//fmt.Printf("Received message on topic: %s\n", message.Topic())
 	//fmt.Printf("Message: %s\n", message.Payload())
@@ -361,6 +511,7 @@ func onMessageReceived(client mqtt.Client, message mqtt.Message) {
 	if message.Topic() == "ratt/control/broadcast/acl/update" {
 		fmt.Println("Got ACL Update message")
 		GetACLList()
+		loadOpenTimes()
 	} else if message.Topic() == topic {
 		fmt.Println("Got OPEN request")
 		if cfg.OpenSecret == "" {
@@ -378,32 +529,56 @@ func onMessageReceived(client mqtt.Client, message mqtt.Message) {
 			return
 		}
 
-		err = VerifyOpenRequestSignature(cfg.OpenSecret, request.Member, request.ToolName, request.Timestamp, request.Signature)
+		err = VerifyRemoteRequest(request, cfg.OpenToolName)
 		if err != nil {
 			fmt.Printf("Open request verification failed: %s\n", err)
 			return
 		}
+		fmt.Printf("Open request member \"%s\" door \"%s\" Timestamp \"%d\" Signature \"%s\"\n", request.Member, request.ToolName, request.Timestamp, request.Signature)
 
-		if cfg.OpenToolName != request.ToolName {
-			fmt.Printf("Wrong toolname \"%s\" - expected \"%s\"\n", request.ToolName, cfg.OpenToolName)
+		if estopActive() {
+			fmt.Println("Emergency stop latched - remote open refused")
+			publishAccess(nil, 0, request.Member, "estop")
 			return
 		}
-		fmt.Printf("Open request member \"%s\" door \"%s\" Timestamp \"%d\" Signature \"%s\"\n", request.Member, request.ToolName, request.Timestamp, request.Signature)
-
-		timestamp := time.Unix(int64(request.Timestamp), 0) // seconds + 0 nanos
-		windowStart := timestamp.Add(-5 * time.Minute)
-		windowEnd := timestamp.Add(5 * time.Minute)
-		now := time.Now()
-
-		if now.Before(windowStart) || now.After(windowEnd) {
-			fmt.Println("Open request timeout")
+		// One signed message is one person - it can't satisfy the two-person rule
+		if cfg.TwoPersonSecs > 0 {
+			fmt.Println("Two-person rule set - remote open refused")
+			publishAccess(nil, 0, request.Member, "twoperson")
 			return
 		}
-
-		var topic string = fmt.Sprintf("ratt/status/node/%s/personality/access", cfg.ClientID)
-		var message string = fmt.Sprintf("{\"allowed\":1,\"member\":\"%s\"}", request.Member)
-		client.Publish(topic, 0, false, message)
-		open_servo(cfg.ServoOpen, cfg.ServoClose, cfg.WaitSecs, cfg.Mode)
+		if overrideDeniesMember(request.Member) {
+			fmt.Printf("Member %s denied by local override - remote open refused\n", request.Member)
+			publishAccessEvent(nil, AccessEvent{Allowed: 0, Member: request.Member, Reason: "override", Override: "deny"})
+			return
+		}
+		publishAccess(nil, 1, request.Member, "")
+		if cfg.Personality == "tool" {
+			ToolRemoteOpen(request.Member)
+			return
+		}
+		// The first reader's door, with its lock held like a badge open
+		r := configuredReaders()[0]
+		if doorHeld(r.DoorPin) {
+			fmt.Println("Door already unlocked")
+			return
+		}
+		openDoor(r, openSecs(request.Member))
+	} else if message.Topic() == myEnrollTopic {
+		fmt.Println("Got ENROLL request")
+		EnrollCommand(message.Payload())
+	} else if message.Topic() == myUnlockTopic {
+		fmt.Println("Got UNLOCK request")
+		UnlockCommand(message.Payload())
+	} else if message.Topic() == myPassbackTopic {
+		fmt.Println("Got PASSBACK CLEAR request")
+		PassbackClearCommand(message.Payload())
+	} else if message.Topic() == myEstopResetTopic {
+		fmt.Println("Got ESTOP RESET request")
+		EstopResetCommand(message.Payload())
+	} else if message.Topic() == myPassCloseTopic {
+		fmt.Println("Got PASS CLOSE request")
+		PassCloseCommand(message.Payload())
 	}
 }
 
@@ -413,106 +588,46 @@ func PingSender() {
 		var topic string = fmt.Sprintf("ratt/status/node/%s/ping", cfg.ClientID)
 		var message string = "{\"status\":\"ok\"}"
 		client.Publish(topic, 0, false, message)
+		publishMetrics()
 		time.Sleep(120 * time.Second)
 	}
 }
 
-// Read from KEYBOARD in simple 10h + cr format
-func readkdb_10h() {
-	fmt.Println("USB 10H Keyboard mode")
-	device, err := evdev.OpenFile(cfg.NFCdevice)
-	if err != nil {
-		log.Fatal("Error Opening NFC device : ", err)
-		return
-	}
-	defer device.Close()
-
-	fmt.Printf("Opened keyboard device: %s\n", device.Name()) // Device name from evdev
-	fmt.Printf("Vendor: 0x%04x, Product: 0x%04x\n", device.ID().Vendor, device.ID().Product)
-	fmt.Println("Listening for keyboard events. Press keys to see output.")
-	fmt.Println("Press Ctrl+C to exit.")
-	ch := device.Poll(context.Background())
-	strbuf := ""
-loop:
-	for {
-		select {
-		case event := <-ch:
-			// channel closed
-			if event == nil {
-				break loop
-			}
-
-			switch event.Type.(type) {
-			case evdev.KeyType:
-				if event.Value == 1 {
-					//log.Printf("received key event: %+v TYPE:%+v/%T", event,event.Type,event.Type)
-					if event.Type == evdev.KeyEnter {
-						number, err := strconv.ParseUint(strbuf, 16, 64)
-						number &= 0xffffffff
-						log.Printf("Got 10h String %s BadgeId %d\n", strbuf, number)
-						if err == nil {
-							BadgeTag(number)
-						} else {
-							log.Printf("Bad hex badge line \"%s\"\n", strbuf)
-						}
-						strbuf = ""
-					} else {
-						//log.Printf("KEY (%d) \"%s\"\n",event.Type,event.Type)
-						s := evdev.KeyType(event.Code).String()
-						//log.Printf("ecode %+v keytype %T \"%v\"\n",event.Code,s,s)
-						strbuf += s
-						//log.Printf("strbuf now \"%s\"\n",strbuf)
-					}
-				}
-
-			}
-		}
-	}
-}
-
-func NFClistener() {
-	if cfg.NFCmode == "wiegland" {
+func NFClistener(r *ReaderConfig) {
+	if r.Mode == "wiegland" {
 		reader := &wiegland.RFIDReader{}
-		if err := reader.Initialize(cfg.NFCdevice, 9600); err != nil {
+		if err := reader.Initialize(r.Device, 9600); err != nil {
 			log.Fatalf("Wiegland init failed: %v", err)
 		}
 		defer reader.Close()
 
 		for {
-			tag, err := reader.GetCard()
+			frame, err := reader.GetFrame()
 			if err != nil {
 				fmt.Println("Weigland error", err)
+			} else if frame.IsKey {
+				KeypadKey(r, frame.Key)
 			} else {
-				if tag != 0 {
-					fmt.Println("Got Wiegland tag", tag)
-					BadgeTag(tag)
+				if frame.Card != 0 {
+					fmt.Println("Got Wiegland tag", frame.Card, "on", r.Name)
+					BadgeTag(r, frame.Card)
 				}
-				time.Sleep(time.Second)
 			}
 
 		}
-	} else if cfg.NFCmode == "10h-kbd" {
+	} else if r.Mode == "10h-kbd" {
 		// 10 hex digits - USB Keyboard device
-		readkdb_10h()
+		readkbd(r, 0)
 	} else {
-		for {
-			// Default - Serial device w/ weird protocol
-			tag := readrfid()
-			//var tag uint64
-			//tag = 0
-			//time.Sleep(time.Second * 3)
-			if tag != 0 {
-				fmt.Println("Got RFID", tag)
-				BadgeTag(tag)
-			}
-		}
+		// Default - Serial device w/ weird protocol (or as per SerialFrame)
+		readrfid(r)
 	}
 }
 
 // This reads regular numbers from the device
-func OLD_NFClistener() {
+func OLD_NFClistener(r *ReaderConfig) {
 
-	file, err := os.Open(cfg.NFCdevice)
+	file, err := os.Open(r.Device)
 	if err != nil {
 		log.Fatal("Error Opening NFC device : ", err)
 		return
@@ -533,7 +648,7 @@ func OLD_NFClistener() {
 		} else {
 			fmt.Println("Got tag number", number)
 		}
-		BadgeTag(number)
+		BadgeTag(r, number)
 	}
 
 	// Check for errors from scanner
@@ -564,11 +679,32 @@ func main() {
 		log.Fatal("Config Decode error: ", err)
 	}
 
+	if flag.Arg(0) == "calibrate" {
+		loadServoMotion()
+		Calibrate(*cfgfile)
+		return
+	}
+
 	if cfg.ClientID == "" {
 		panic("ClientID missing in Config file")
 	}
+	loadSchedules()
+	loadPersonality()
+	loadCurrentSense()
+	loadStoragePass()
+	loadPasses()
+	loadLEDPatterns()
+	loadLEDStrip()
+	loadDisplay()
+	loadSound()
+	loadServoMotion()
 
 	myOpenTopic = fmt.Sprintf("ratt/control/node/%s/open", cfg.ClientID)
+	myEnrollTopic = fmt.Sprintf("ratt/control/node/%s/enroll", cfg.ClientID)
+	myUnlockTopic = fmt.Sprintf("ratt/control/node/%s/unlock", cfg.ClientID)
+	myPassbackTopic = fmt.Sprintf("ratt/control/node/%s/passback/clear", cfg.ClientID)
+	myEstopResetTopic = fmt.Sprintf("ratt/control/node/%s/estop/reset", cfg.ClientID)
+	myPassCloseTopic = fmt.Sprintf("ratt/control/node/%s/pass/close", cfg.ClientID)
 	if cfg.LEDpipe != "" {
 		LEDfile, err = os.OpenFile(cfg.LEDpipe, os.O_RDWR, 0644)
 		if LEDfile == nil {
@@ -594,8 +730,14 @@ func main() {
 	}
 	hw.ZeroPinEventDetectMask()
 
+	homeDoors()
+	loadUnlockState()
+	loadPassback()
+	loadSafety()
+	loadOpenTimes()
+	loadOverrides()
 	if *openflag {
-		open_servo(cfg.ServoOpen, cfg.ServoClose, cfg.WaitSecs, cfg.Mode)
+		holdOpenOverride()
 	}
 
 	// MQTT broker address
@@ -660,12 +802,30 @@ func main() {
 	}
 	hw.Close()
 
-	LEDupdateIdleString(LEDconnectionLost)
-	LEDwriteString(LEDconnectionLost)
+	ledRefresh()
 
 	go mqttconnect()
-	go NFClistener()
+	go SafetyMonitor()
+	for _, r := range configuredReaders() {
+		go NFClistener(r)
+	}
+	for _, r := range configuredReaders() {
+		if r.PinDevice != "" {
+			go readkbd(&ReaderConfig{Name: r.Name + "-pinpad", Device: r.PinDevice, pinFor: r}, 2)
+		}
+	}
 	go PingSender()
+	go OverrideWatcher()
+	go OpenTimesWatcher()
+	go PassMonitor()
+	go DisplayUpdater()
+	go SoundPlayer()
+	go DoorbellMonitor()
+	if sc := storageConfig(); cfg.Personality == "storage" && sc.VerifyDevice != "" {
+		go readkbd(&ReaderConfig{Name: "verify", Device: sc.VerifyDevice}, 3)
+	}
+	go UnlockScheduler()
+	go CurrentSense()
 
 	//dymo_label("- Ready -")
 	// Wait for a signal to exit
@@ -680,5 +840,5 @@ func main() {
 	// Disconnect from the MQTT broker
 	client.Disconnect(250)
 	fmt.Println("Disconnected from the MQTT broker")
-	LEDwriteString(LEDterminated)
+	ledTerminate()
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"goratt/dymo"
+)
+
+// Label printing. A label is an SVG template with {{field}} placeholders
+// and an empty <g id="barcode"/> for a Code 39 barcode. It is rasterized
+// with rsvg-convert and printed through CUPS (lp), or raw to a LabelWriter
+// with the dymo package.
+
+// Code 39 - which of the 9 elements (bar, space, bar...) are wide
+var code39 = map[rune]string{
+	'0': "000110100", '1': "100100001", '2': "001100001", '3': "101100000",
+	'4': "000110001", '5': "100110000", '6': "001110000", '7': "000100101",
+	'8': "100100100", '9': "001100100", 'A': "100001001", 'B': "001001001",
+	'C': "101001000", 'D': "000011001", 'E': "100011000", 'F': "001011000",
+	'G': "000001101", 'H': "100001100", 'I': "001001100", 'J': "000011100",
+	'K': "100000011", 'L': "001000011", 'M': "101000010", 'N': "000010011",
+	'O': "100010010", 'P': "001010010", 'Q': "000000111", 'R': "100000110",
+	'S': "001000110", 'T': "000010110", 'U': "110000001", 'V': "011000001",
+	'W': "111000000", 'X': "010010001", 'Y': "110010000", 'Z': "011010000",
+	'-': "010000101", '.': "110000100", ' ': "011000100", '*': "010010100",
+	'$': "010101000", '/': "010100010", '+': "010001010", '%': "000101010",
+}
+
+// Barcode area in template units
+const (
+	barcodeWidth  = 135.0
+	barcodeHeight = 19.0
+)
+
+// SVG rects for a Code 39 barcode of s, fitted to barcodeWidth
+func code39SVG(s string) (string, error) {
+	s = "*" + strings.ToUpper(s) + "*"
+	var widths []int // Alternating bar/space widths in modules
+	for i, c := range s {
+		pattern, ok := code39[c]
+		if !ok || (c == '*' && i != 0 && i != len(s)-1) {
+			return "", fmt.Errorf("can't encode '%c' in Code 39", c)
+		}
+		for _, w := range pattern {
+			if w == '1' {
+				widths = append(widths, 3)
+			} else {
+				widths = append(widths, 1)
+			}
+		}
+		widths = append(widths, 1) // Gap between characters
+	}
+	widths = widths[:len(widths)-1]
+
+	modules := 0
+	for _, w := range widths {
+		modules += w
+	}
+	module := barcodeWidth / float64(modules)
+
+	var b strings.Builder
+	x := 0
+	for i, w := range widths {
+		if i%2 == 0 {
+			fmt.Fprintf(&b, "<rect x=\"%.3f\" y=\"0\" width=\"%.3f\" height=\"%.1f\" style=\"fill:#000000\" />",
+				float64(x)*module, float64(w)*module, barcodeHeight)
+		}
+		x += w
+	}
+	return b.String(), nil
+}
+
+var barcodeSlot = regexp.MustCompile(`<g\s+id="barcode"([^>]*?)\s*/>`)
+
+// Fill in a label template
+func fillLabel(template []byte, fields map[string]string, barcode string) ([]byte, error) {
+	out := string(template)
+	for k, v := range fields {
+		var esc bytes.Buffer
+		xml.EscapeText(&esc, []byte(v))
+		out = strings.Replace(out, "{{"+k+"}}", esc.String(), -1)
+	}
+	if barcode != "" {
+		rects, err := code39SVG(barcode)
+		if err != nil {
+			return nil, err
+		}
+		if !barcodeSlot.MatchString(out) {
+			return nil, fmt.Errorf("template has no barcode slot")
+		}
+		out = barcodeSlot.ReplaceAllString(out, `<g id="barcode"$1>`+rects+`</g>`)
+	}
+	return []byte(out), nil
+}
+
+// Rasterize an SVG to PNG. width/height of 0 keep the SVG's own size.
+func rasterizeLabel(svg []byte, width int, height int) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "goratt-label")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "label.svg")
+	out := filepath.Join(dir, "label.png")
+	if err := ioutil.WriteFile(in, svg, 0644); err != nil {
+		return nil, err
+	}
+
+	args := []string{"-b", "white", "-o", out}
+	if width > 0 {
+		args = append(args, "-w", strconv.Itoa(width))
+	}
+	if height > 0 {
+		args = append(args, "-h", strconv.Itoa(height))
+	}
+	args = append(args, in)
+	if msg, err := exec.Command("rsvg-convert", args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("rsvg-convert: %v: %s", err, strings.TrimSpace(string(msg)))
+	}
+	return ioutil.ReadFile(out)
+}
+
+// Print a PNG through CUPS
+func printLP(queue string, pngData []byte) error {
+	args := []string{}
+	if queue != "" {
+		args = append(args, "-d", queue)
+	}
+	cmd := exec.Command("lp", args...)
+	cmd.Stdin = bytes.NewReader(pngData)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("lp: %v: %s", err, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Print a PNG raw to a LabelWriter
+func printRaw(device string, media dymo.Media, pngData []byte) error {
+	img, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		return err
+	}
+	d, err := dymo.Open(device)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Print(img, media)
+}
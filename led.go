@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"goratt/ws2812"
+)
+
+// LED pipe patterns. Everything the LEDs show has a name, and LEDPatterns
+// in the config can map any name to a different neotool pattern string.
+//
+// The LEDs normally show a state (idle, offline, held-open, an alarm...)
+// worked out from what the node is doing. Events like granted or denied
+// show a temporary pattern that reverts to the state when it is done. Each
+// name has a priority, so nothing covers up something more important - a
+// swipe doesn't hide an e-stop.
+
+type ledDefault struct {
+	pattern  string
+	priority int
+	fallback string // Configured pattern to use if this one isn't
+}
+
+const (
+	ledPrioState   = 0
+	ledPrioMode    = 1
+	ledPrioEvent   = 2
+	ledPrioLockout = 3
+	ledPrioAlarm   = 4
+)
+
+var ledDefaults = map[string]ledDefault{
+	// States
+	"offline":     {"@2 !150000 001010", ledPrioState, ""},
+	"idle":        {"@3 !150000 400000", ledPrioState, ""},
+	"held-open":   {"@3 !150000 004000", ledPrioState, ""},
+	"enroll":      {"@3 !50000 400040", ledPrioMode, ""},
+	"tool-active": {"@3 !100000 8000", ledPrioMode, ""},
+	"lockout":     {"@2 !20000 ff00ff", ledPrioLockout, ""},
+	"estop":       {"@2 !5000 ff", ledPrioAlarm, "alarm"},
+	"fire":        {"@2 !10000 00ffff", ledPrioAlarm, "alarm"},
+	"terminated":  {"@0 010101", ledPrioAlarm, ""},
+	// Events
+	"granted":         {"@1 !50000 8000", ledPrioEvent, ""},
+	"denied":          {"@2 !10000 ff", ledPrioEvent, ""},
+	"schedule-denied": {"@2 !10000 0040ff", ledPrioEvent, "denied"},
+	"pinwait":         {"@2 !50000 404000", ledPrioEvent, ""},
+	"second-person":   {"@3 !30000 404000", ledPrioEvent, ""},
+	"timeout-warning": {"@2 !20000 0080ff", ledPrioEvent, ""},
+}
+
+// Built-in driver for a strip on SPI, instead of (or as well as) neotool
+type LEDStripConfig struct {
+	Device     string `yaml:"Device"`     // Default /dev/spidev0.0
+	Count      int    `yaml:"Count"`      // LEDs on the strip (Default 7)
+	Type       string `yaml:"Type"`       // "ws2812" (Default), "sk6812" or "sk6812w" (RGBW)
+	Brightness int    `yaml:"Brightness"` // 1-255 (Default 255)
+}
+
+var LEDfile *os.File
+var ledStrip *ws2812.Strip
+
+var ledMutex sync.Mutex
+var ledOnline bool    // MQTT connected
+var ledShowing string // Temporary pattern up, if any
+var ledGen int        // Bumped each time a temporary pattern goes up
+
+// Check LEDPatterns at startup
+func loadLEDPatterns() {
+	for name, pattern := range cfg.LEDPatterns {
+		if _, ok := ledDefaults[name]; !ok && name != "alarm" {
+			log.Fatalf("Unknown LEDPatterns name \"%s\"", name)
+		}
+		if _, err := ws2812.ParsePattern(pattern); err != nil {
+			log.Fatalf("LEDPatterns %s: %v", name, err)
+		}
+	}
+}
+
+func ledPattern(name string) string {
+	if p, ok := cfg.LEDPatterns[name]; ok {
+		return p
+	}
+	d := ledDefaults[name]
+	if p, ok := cfg.LEDPatterns[d.fallback]; ok && d.fallback != "" {
+		return p
+	}
+	return d.pattern
+}
+
+func ledPriority(name string) int {
+	return ledDefaults[name].priority
+}
+
+func LEDwriteString(str string) {
+	if LEDfile != nil {
+		LEDfile.Write([]byte(str))
+	}
+	if ledStrip != nil {
+		if err := ledStrip.SetPattern(str); err != nil {
+			fmt.Printf("Bad LED pattern \"%s\": %v\n", str, err)
+		}
+	}
+}
+
+// Start the built-in strip driver, if configured
+func loadLEDStrip() {
+	sc := cfg.LEDStrip
+	if sc == nil {
+		return
+	}
+	device := sc.Device
+	if device == "" {
+		device = "/dev/spidev0.0"
+	}
+	count := sc.Count
+	if count <= 0 {
+		count = 7
+	}
+	white := false
+	switch sc.Type {
+	case "", "ws2812", "sk6812":
+	case "sk6812w":
+		white = true
+	default:
+		log.Fatalf("Unknown LEDStrip Type \"%s\"", sc.Type)
+	}
+	if size, max := ws2812.FrameSize(count, white), ws2812.SpidevBufsiz(); size > max {
+		log.Fatalf("LEDStrip of %d LEDs needs %d bytes per frame, more than spidev's bufsiz of %d - set spidev.bufsiz=%d in cmdline.txt", count, size, max, size)
+	}
+	spi, err := ws2812.OpenSPI(device)
+	if err != nil {
+		log.Fatal("Error opening LED strip: ", err)
+	}
+	ledStrip = ws2812.NewStrip(spi, count, white, sc.Brightness)
+	go ledStrip.Run()
+}
+
+// What the LEDs show when nothing temporary is up, most important first
+func ledState() string {
+	switch {
+	case estopActive():
+		return "estop"
+	case fireAlarmActive():
+		return "fire"
+	case anyReaderLockedOut():
+		return "lockout"
+	case enrollActive():
+		return "enroll"
+	case toolSessionActive():
+		return "tool-active"
+	case doorsUnlocked():
+		return "held-open"
+	}
+	ledMutex.Lock()
+	defer ledMutex.Unlock()
+	if ledOnline {
+		return "idle"
+	}
+	return "offline"
+}
+
+// Something the state depends on changed - show it, unless a temporary
+// pattern that matters more is up
+func ledRefresh() {
+	state := ledState()
+	ledMutex.Lock()
+	defer ledMutex.Unlock()
+	if ledShowing != "" {
+		if ledPriority(ledShowing) > ledPriority(state) {
+			return
+		}
+		ledShowing = ""
+	}
+	LEDwriteString(ledPattern(state))
+}
+
+// Show a temporary pattern for d (until ledEnd if d is 0), then go back to
+// the state. Ignored if something more important is showing.
+func ledShow(name string, d time.Duration) {
+	state := ledState()
+	ledMutex.Lock()
+	defer ledMutex.Unlock()
+	prio := ledPriority(name)
+	if prio < ledPriority(state) || (ledShowing != "" && prio < ledPriority(ledShowing)) {
+		debugf("LED %s hidden by %s/%s\n", name, state, ledShowing)
+		return
+	}
+	ledShowing = name
+	ledGen++
+	LEDwriteString(ledPattern(name))
+	if d > 0 {
+		gen := ledGen
+		time.AfterFunc(d, func() {
+			ledMutex.Lock()
+			current := ledGen == gen
+			ledMutex.Unlock()
+			if current {
+				ledEnd(name)
+			}
+		})
+	}
+}
+
+// Take down a temporary pattern, if it is still up
+func ledEnd(name string) {
+	ledMutex.Lock()
+	if ledShowing != name {
+		ledMutex.Unlock()
+		return
+	}
+	ledShowing = ""
+	ledMutex.Unlock()
+	ledRefresh()
+}
+
+// MQTT connected or lost
+func ledSetOnline(online bool) {
+	ledMutex.Lock()
+	ledOnline = online
+	ledMutex.Unlock()
+	ledRefresh()
+}
+
+// Final pattern on the way out
+func ledTerminate() {
+	ledMutex.Lock()
+	defer ledMutex.Unlock()
+	ledShowing = "terminated"
+	LEDwriteString(ledPattern("terminated"))
+}
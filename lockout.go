@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Brute-force lockout. Denied swipes are counted per reader and per
+// credential over a sliding window; too many puts the reader into a timed
+// lockout where only admin badges are honoured.
+
+type LockoutConfig struct {
+	WindowSecs      int  `yaml:"WindowSecs"`
+	ReaderThreshold int  `yaml:"ReaderThreshold"`
+	TagThreshold    int  `yaml:"TagThreshold"`
+	LockoutSecs     int  `yaml:"LockoutSecs"`
+	AdminLevel      *int `yaml:"AdminLevel"`
+}
+
+// Alarm - off the wire
+type AlarmEvent struct {
+	Alarm  string `json:"alarm"`
+	Active bool   `json:"active"`
+	Reader string `json:"reader,omitempty"`
+	Tag    uint64 `json:"tag,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+var lockoutMutex sync.Mutex
+var deniedByReader = make(map[string][]time.Time)
+var deniedByTag = make(map[uint64][]time.Time)
+var lockedUntil = make(map[string]time.Time)
+var lockoutTimers = make(map[string]*time.Timer)
+
+func publishAlarm(ev AlarmEvent) {
+	message, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Println("Error encoding alarm:", err)
+		return
+	}
+	var topic string = fmt.Sprintf("ratt/status/node/%s/alarm", cfg.ClientID)
+	client.Publish(topic, 0, false, message)
+}
+
+// Drop attempts that have slid out of the window
+func pruneAttempts(times []time.Time, window time.Duration) []time.Time {
+	recent := times[:0]
+	for _, t := range times {
+		if time.Since(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// Drop every credential with nothing left in the window. Pruning only the
+// tag being recorded would let someone cycling through credentials grow the
+// map without limit.
+func pruneDeniedTags(window time.Duration) {
+	for id, times := range deniedByTag {
+		if recent := pruneAttempts(times, window); len(recent) > 0 {
+			deniedByTag[id] = recent
+		} else {
+			delete(deniedByTag, id)
+		}
+	}
+}
+
+func isAdmin(tag ACLlist) bool {
+	lc := cfg.Lockout
+	return lc != nil && lc.AdminLevel != nil && tag.Allowed && tag.Level >= *lc.AdminLevel
+}
+
+func readerLockedOut(r *ReaderConfig) bool {
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	return time.Now().Before(lockedUntil[r.Name])
+}
+
+func anyReaderLockedOut() bool {
+	lockoutMutex.Lock()
+	defer lockoutMutex.Unlock()
+	for _, until := range lockedUntil {
+		if time.Now().Before(until) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count a denied swipe, and lock the reader out if it is one too many.
+// Returns true if this swipe started a lockout.
+func recordDenied(r *ReaderConfig, id uint64) bool {
+	lc := cfg.Lockout
+	if lc == nil {
+		return false
+	}
+	window := time.Duration(lc.WindowSecs) * time.Second
+	if window <= 0 {
+		window = time.Minute
+	}
+
+	lockoutMutex.Lock()
+	pruneDeniedTags(window)
+	deniedByReader[r.Name] = append(pruneAttempts(deniedByReader[r.Name], window), time.Now())
+	deniedByTag[id] = append(deniedByTag[id], time.Now())
+	readerCount := len(deniedByReader[r.Name])
+	tagCount := len(deniedByTag[id])
+
+	detail := ""
+	if lc.ReaderThreshold > 0 && readerCount >= lc.ReaderThreshold {
+		detail = fmt.Sprintf("%d denied swipes on reader", readerCount)
+	} else if lc.TagThreshold > 0 && tagCount >= lc.TagThreshold {
+		detail = fmt.Sprintf("%d denied swipes of tag", tagCount)
+	}
+	if detail == "" {
+		lockoutMutex.Unlock()
+		return false
+	}
+
+	duration := time.Duration(lc.LockoutSecs) * time.Second
+	if duration <= 0 {
+		duration = 5 * time.Minute
+	}
+	lockedUntil[r.Name] = time.Now().Add(duration)
+	delete(deniedByReader, r.Name)
+	delete(deniedByTag, id)
+	if t := lockoutTimers[r.Name]; t != nil {
+		t.Stop()
+	}
+	lockoutTimers[r.Name] = time.AfterFunc(duration, func() { endLockout(r, "timeout") })
+	lockoutMutex.Unlock()
+
+	fmt.Printf("Reader %s locked out: %s\n", r.Name, detail)
+	publishAlarm(AlarmEvent{Alarm: "lockout", Active: true, Reader: r.Name, Tag: id, Detail: detail})
+	ledRefresh()
+	soundPlay("alarm")
+	return true
+}
+
+// Lockout over - timed out, or cleared by an admin badge
+func endLockout(r *ReaderConfig, why string) {
+	lockoutMutex.Lock()
+	if _, ok := lockedUntil[r.Name]; !ok {
+		lockoutMutex.Unlock()
+		return
+	}
+	delete(lockedUntil, r.Name)
+	if t := lockoutTimers[r.Name]; t != nil {
+		t.Stop()
+		delete(lockoutTimers, r.Name)
+	}
+	lockoutMutex.Unlock()
+
+	fmt.Printf("Reader %s lockout ended (%s)\n", r.Name, why)
+	publishAlarm(AlarmEvent{Alarm: "lockout", Active: false, Reader: r.Name, Detail: why})
+	ledRefresh()
+}
+
+// Reader is locked out - only admins and override allows get through (and
+// clear the lockout).
+// Returns true if the swipe should be ignored.
+func lockoutBlocks(r *ReaderConfig, id uint64) bool {
+	if !readerLockedOut(r) {
+		return false
+	}
+	tag, ok := lookupTag(id)
+	if ok && (isAdmin(tag) || tag.Override == "allow") {
+		endLockout(r, "admin "+tag.Member)
+		return false
+	}
+	fmt.Printf("Reader %s locked out - ignoring tag %d\n", r.Name, id)
+	countMetric(r.Name + ".lockout_ignored")
+	return true
+}
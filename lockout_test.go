@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeniedTagsPruned(t *testing.T) {
+	cfg.Lockout = &LockoutConfig{WindowSecs: 60, TagThreshold: 3}
+	defer func() {
+		cfg.Lockout = nil
+		deniedByReader = make(map[string][]time.Time)
+		deniedByTag = make(map[uint64][]time.Time)
+	}()
+	r := &ReaderConfig{Name: "test"}
+
+	// Credentials cycled through long ago, each seen once
+	old := time.Now().Add(-2 * time.Minute)
+	for id := uint64(1); id <= 1000; id++ {
+		deniedByTag[id] = []time.Time{old}
+	}
+	deniedByTag[5000] = []time.Time{time.Now()}
+
+	if recordDenied(r, 9999) {
+		t.Fatal("locked out")
+	}
+	if len(deniedByTag) != 2 || len(deniedByTag[9999]) != 1 || len(deniedByTag[5000]) != 1 {
+		t.Errorf("%d tags left: %v", len(deniedByTag), deniedByTag)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Simple counters (e.g. reader decode errors), published with each ping
+
+var metricsMutex sync.Mutex
+var metrics = make(map[string]uint64)
+
+func countMetric(name string) {
+	metricsMutex.Lock()
+	metrics[name]++
+	metricsMutex.Unlock()
+}
+
+func publishMetrics() {
+	metricsMutex.Lock()
+	message, err := json.Marshal(metrics)
+	metricsMutex.Unlock()
+	if err != nil {
+		fmt.Println("Error encoding metrics:", err)
+		return
+	}
+	var topic string = fmt.Sprintf("ratt/status/node/%s/metrics", cfg.ClientID)
+	client.Publish(topic, 0, false, message)
+}
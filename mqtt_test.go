@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT client that records what is published, so code that reports over
+// MQTT can run in tests. Anything else panics on the nil embedded Client.
+type testClient struct {
+	mqtt.Client
+	mutex     sync.Mutex
+	published []testMessage
+}
+
+type testMessage struct {
+	topic   string
+	payload string
+}
+
+func (c *testClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var p string
+	switch v := payload.(type) {
+	case []byte:
+		p = string(v)
+	case string:
+		p = v
+	}
+	c.published = append(c.published, testMessage{topic, p})
+	return &mqtt.DummyToken{}
+}
+
+func (c *testClient) messages() []testMessage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]testMessage(nil), c.published...)
+}
+
+// Swap in a testClient for the length of a test
+func useTestClient(cleanup func(func())) *testClient {
+	c := &testClient{}
+	old := client
+	client = c
+	cleanup(func() { client = old })
+	return c
+}
@@ -6,60 +6,174 @@ import (
     "github.com/kenshaw/evdev"
     "context"
 	"github.com/tarm/serial"
-	"bytes"
+	"io"
     "time"
     "fmt"
     "github.com/hjkoskel/govattu"
+    "encoding/json"
 )
 
 
-// This tag number tried to badge in
-func BadgeTag(id uint64) {
-	var found bool = false
-  var allowed=0
-	for _,tag := range validTags {
-		if id == tag.Tag {
-			found = true
-			access := "Denied"
-			if (tag.Allowed) { 
-        access = "Allowed" 
-        allowed = 1
-      }
-			fmt.Printf("Tag %d Member %s Access %s",id,tag.Member,access)
+// This tag number tried to badge in on reader r
+func BadgeTag(r *ReaderConfig, id uint64) {
+	// Card held against the reader - ignore repeats
+	if (r.duplicate(id)) {
+		debugf("Duplicate tag %d on %s ignored\n",id,r.Name)
+		return
+	}
+	defer r.markSeen(id)
+
+	// E-stop beats everything
+	if (safetyBlocks(r,id)) {
+		return
+	}
 
-			var topic string = fmt.Sprintf("ratt/status/node/%s/personality/access",cfg.ClientID)
-			var message string = fmt.Sprintf("{\"allowed\":%d,\"member\":\"%s\"}",allowed,tag.Member)
-			client.Publish(topic,0,false,message)
+	if (lockoutBlocks(r,id)) {
+		return
+	}
 
-			if (tag.Allowed) {
-				open_servo(cfg.ServoOpen, cfg.ServoClose, cfg.WaitSecs, cfg.Mode)
-			  return
+	// Tool personality - current member swiping out
+	if (toolBadgeOut(id)) {
+		return
+	}
+
+	var allowed=0
+	tag, found := lookupTag(id)
+	if (found) {
+		// Local override deny beats everything in the ACL
+		if (tag.Override == "deny") {
+			fmt.Printf("Tag %d Member %s denied by local override\n",id,tag.Member)
+			publishAccessEvent(r,AccessEvent{Allowed: 0, Member: tag.Member, Reason: "override", Override: tag.Override})
+			if (!recordDenied(r,id)) {
+				accessDenied("denied")
+			}
+			return
+		}
+		if (isEnrollBadge(tag)) {
+			if (EnrollBadge(r,tag)) {
+				return
 			}
-		} 
+			defer enrollSwipeHandled(r,tag)
+		}
+		tag = traineeOf(tag)
+		// Local override allow is for emergencies - no schedule, passback or PIN
+		if (scheduleDenies(tag,time.Now())) {
+			fmt.Printf("Tag %d Member %s outside schedule for level %d\n",id,tag.Member,tag.Level)
+			publishAccess(r,0,tag.Member,"schedule")
+			if (!recordDenied(r,id)) {
+				accessDenied("schedule-denied")
+			}
+			return
+		}
+		if (tag.admitted() && tag.Override == "" && passbackDenies(r,tag)) {
+			publishAccess(r,0,tag.Member,"passback")
+			accessDenied("denied")
+			return
+		}
+		// Badge + PIN: don't announce the grant until the PIN is in
+		if (tag.admitted() && tag.Override == "" && cfg.PinRequired) {
+			fmt.Printf("Tag %d Member %s waiting for PIN\n",id,tag.Member)
+			RequestPin(r,tag)
+			return
+		}
+		access := "Denied"
+		if (tag.admitted()) { 
+        access = "Allowed" 
+        allowed = 1
+      }
+		fmt.Printf("Tag %d Member %s Access %s Reader %s\n",id,tag.Member,access,r.Name)
 
+		if (tag.admitted()) {
+			grantAccess(r,tag)
+		  return
+		}
+		publishAccess(r,allowed,tag.Member,"")
 	}
 
 	if (found == false) {
 		fmt.Println("Tag not found",id)
+		if (UnknownTag(r,id)) {
+			return
+		}
+		displayAccess(AccessEvent{Allowed: 0, Reason: "unknown"})
+		soundPlay("denied")
+	}
+	if (!recordDenied(r,id)) {
+		accessDenied("denied")
+	}
+}
+
+// ACL entry for a tag number, with any local override applied
+func lookupTag(id uint64) (ACLlist, bool) {
+	if tag, ok := overrideTag(id); ok {
+		return tag, true
+	}
+	for _,tag := range validTags {
+		if id == tag.Tag {
+			return tag, true
+		}
 	}
+	return ACLlist{}, false
+}
+
+// Access event - off the wire
+type AccessEvent struct {
+	Allowed   int      `json:"allowed"`
+	Member    string   `json:"member"`
+	Reason    string   `json:"reason,omitempty"`
+	Reader    string   `json:"reader,omitempty"`
+	Direction string   `json:"direction,omitempty"`
+	Members   []string `json:"members,omitempty"`
+	Trainer   string   `json:"trainer,omitempty"`
+	Override  string   `json:"override,omitempty"` // Local override "allow" or "deny" hit
+}
+
+// Publish an access event. r is nil for remote opens, reason is optional
+func publishAccess(r *ReaderConfig, allowed int, member string, reason string) {
+	publishAccessEvent(r, AccessEvent{Allowed: allowed, Member: member, Reason: reason})
+}
+
+func publishAccessEvent(r *ReaderConfig, ev AccessEvent) {
+	if (r != nil) {
+		ev.Reader = r.Name
+		ev.Direction = r.Direction
+	}
+	message, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Println("Error encoding access event:", err)
+		return
+	}
+	var topic string = fmt.Sprintf("ratt/status/node/%s/personality/access",cfg.ClientID)
+	client.Publish(topic,0,false,message)
+	displayAccess(ev)
+	if (ev.Allowed == 1) {
+		soundPlay("granted")
+	} else {
+		soundPlay("denied")
+	}
+}
+
+// Red LED and denied pattern for a few seconds, then back to idle
+func accessDenied(name string) {
 	hw, err := govattu.Open()
 	if err != nil {
 		panic(err)
 	}
 	defer  hw.Close()
 	hw.PinSet(23)
-  LEDwriteString(LEDaccessDenied)
+  ledShow(name,3*time.Second)
 	time.Sleep(time.Duration(3) * time.Second)
 	hw.PinClear(23)
-  LEDwriteString(LEDidleString)
 	return
 }
 // Read from KEYBOARD in simple 10h + cr format
-func readkbd(devtype int) {
+// devtype 0 = hex badge, 1 = decimal badge, 2 = PIN keypad (keys passed through),
+// 3 = storage pass barcode (verify mode)
+func readkbd(r *ReaderConfig, devtype int) {
 	log.Println("USB 10H Keyboard mode")
-	device,err := evdev.OpenFile(cfg.NFCdevice)
+	device,err := evdev.OpenFile(r.Device)
 	if (err != nil) {
-		log.Fatal("Error Opening NFC device : ",err)
+		log.Fatal("Error Opening keyboard device ",r.Device," : ",err)
 		return
 	}
 	defer device.Close()
@@ -84,9 +198,16 @@ func readkbd(devtype int) {
 			case evdev.KeyType:
                 if (event.Value == 1) {
                         //log.Printf("received key event: %+v TYPE:%+v/%T", event,event.Type,event.Type)
+                        if (devtype == 2) {
+                                KeypadEvdevKey(r.pinFor,evdev.KeyType(event.Code))
+                                continue
+                        }
                         // We do this so we can map a GPIO as an escape key easily if we want
                         if (event.Type == evdev.KeyEscape) {
-                                //Signout()
+                                Signout()
+                        } else if (event.Type == evdev.KeyEnter && devtype == 3) {
+                                VerifyPass(strbuf)
+                                strbuf = ""
                         } else if (event.Type == evdev.KeyEnter) {
                                 var number uint64
                                 if (devtype == 0) {
@@ -97,7 +218,7 @@ func readkbd(devtype int) {
                                 number &= 0xffffffff
                                 log.Printf("Got String %s BadgeId %d\n",strbuf,number)
                                 if (err == nil) {
-                                        BadgeTag(number)
+                                        BadgeTag(r,number)
                                 } else {
                                         log.Printf("Bad hex badge line \"%s\"\n",strbuf)
                                 }
@@ -106,6 +227,10 @@ func readkbd(devtype int) {
                                 //log.Printf("KEY (%d) \"%s\"\n",event.Type,event.Type)
                                 s := evdev.KeyType(event.Code).String()
                                 //log.Printf("ecode %+v keytype %T \"%v\"\n",event.Code,s,s)
+                                // Barcode scanners send shift etc. - keep only characters
+                                if (devtype == 3 && len(s) != 1) {
+                                        continue
+                                }
                                 strbuf += s
                                 //log.Printf("strbuf now \"%s\"\n",strbuf)
                         }
@@ -116,81 +241,54 @@ func readkbd(devtype int) {
 	}
 }
 
-// THis reads from the weird USB RFID Serial Protocol w/ Weird Encoding
+// This reads from a serial RFID reader, framed per the reader's FrameSpec.
+// The default is the weird USB RFID Serial Protocol w/ Weird Encoding
 
-func readrfid() uint64  {
-      // Open the serial port
-    //mode := &serial.Mode{
-    //  BaudRate: 115200,
-   // }
-    //port, err := serial.Open(cfg.NFCdevice,mode)
-		c := &serial.Config{Name: cfg.NFCdevice, Baud: 115200, ReadTimeout: time.Second}
+func readrfid(r *ReaderConfig) {
+    spec := r.frameSpec()
+    log.Printf("Reader %s serial frame: %s\n",r.Name,spec)
+		c := &serial.Config{Name: r.Device, Baud: spec.Baud, ReadTimeout: time.Second}
     port, err := serial.OpenPort(c)
     if err != nil {
-			panic(fmt.Errorf("Canot open tty %s: %v",cfg.NFCdevice,err))
+			panic(fmt.Errorf("Canot open tty %s: %v",r.Device,err))
     }
-    buff := make([]byte, 9)
+    defer port.Close()
+    buff := make([]byte, 64)
+    var pending []byte
     for {
-			//fmt.Println("READING")
     	n, err := port.Read(buff)
-			//fmt.Println("READ EXIT")
-      if err != nil {
-			  //fmt.Printf("Fatalbreak %v\n",err)
-        //log.Fatal(err)
-        break
-      }
-      if n == 0 {
-        //fmt.Println("\nEOF SLEEP")
+      if err != nil && err != io.EOF {
+        fmt.Printf("Reader %s read error: %v\n",r.Name,err)
 				time.Sleep(time.Second * 5)
-        //fmt.Println("\nENDSLEEP")
         continue
       }
-      if n != 9 {
-        //fmt.Println("\nPARTIAL")
-       continue
+      if n == 0 {
+        // Timeout - anything left over is a partial frame
+        if (len(pending) > 0) {
+          countMetric(r.Name + ".partial_frames")
+          pending = pending[:0]
+        }
+        continue
       }
-      //fmt.Printf("%x", string(buff[:n]))
-      break
-    }
-
-			// fmt.Printf("\nGotdata\n")
-
-        // Define the preambles and terminator
-    preambles := []byte{0x02, 0x09}
-    terminator := []byte{0x03}
+      pending = append(pending, buff[:n]...)
 
-
-    // Verify the preambles
-    if !bytes.Equal(buff[0:2], preambles) {
-      //panic(fmt.Errorf("invalid preambles: %v", buff[0:2]))
-			return 0
-    }
-
-    // Verify the terminator
-    if !bytes.Equal(buff[8:9], terminator) {
-      //panic(fmt.Errorf("invalid terminator: %v", buff[8:9]))
-			return 0
-    }
-
-
-    // Print the data
-    //fmt.Println(buff)
-    data := buff[1:7]
-    // XOR all the bytes in the slice
-    xor := data[0]
-    for i := 1; i < len(data); i++ {
-        xor ^= data[i]
-        //fmt.Printf("Byte %d is %x\n",i,data[i])
-    }
-
-    var tagno uint64
-    tagno= (uint64(data[2]) << 24) | (uint64(data[3])<<16) | (uint64(data[4]) <<8 ) | uint64(data[5])
-    //fmt.Printf("XOR is %x should be %x Tagno %d\n",xor,buff[7],tagno)
-    if xor!= buff[7] {
-      return 0
+      for {
+        frame, rest := spec.nextFrame(pending)
+        pending = append(pending[:0], rest...)
+        if frame == nil {
+          break
+        }
+        countMetric(r.Name + ".frames")
+        tag, err := spec.decodeFrame(frame)
+        if err != nil {
+          countMetric(r.Name + ".decode_errors")
+          fmt.Printf("Reader %s decode error: %v\n",r.Name,err)
+          continue
+        }
+        if tag != 0 {
+          fmt.Println("Got RFID", tag, "on", r.Name)
+          BadgeTag(r, tag)
+        }
+      }
     }
-
-    return tagno
-
 }
-
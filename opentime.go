@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-member door open time. Members who need longer (wheelchairs, carts)
+// get it from open_secs in the ACL, or from OpenTimesFile, which wins. Either
+// way it is capped at MaxOpenSecs.
+
+var openTimesMutex sync.Mutex
+var openTimes = make(map[string]int) // Member -> seconds, from OpenTimesFile
+var openTimesModTime time.Time
+
+// Read OpenTimesFile - "member seconds" per line, # for comments
+func loadOpenTimes() {
+	if cfg.OpenTimesFile == "" {
+		return
+	}
+	file, err := os.Open(cfg.OpenTimesFile)
+	if err != nil {
+		fmt.Println("Error reading open times file: ", err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		fmt.Println("Error reading open times file: ", err)
+		return
+	}
+
+	times := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var member string
+		var secs int
+		if n, _ := fmt.Sscanf(line, "%s %d", &member, &secs); n != 2 || secs <= 0 {
+			fmt.Printf("Bad open times line \"%s\"\n", line)
+			continue
+		}
+		times[member] = secs
+	}
+
+	openTimesMutex.Lock()
+	openTimes = times
+	openTimesModTime = info.ModTime()
+	openTimesMutex.Unlock()
+}
+
+// Watch OpenTimesFile for changes
+func OpenTimesWatcher() {
+	if cfg.OpenTimesFile == "" {
+		return
+	}
+	for {
+		time.Sleep(5 * time.Second)
+		info, err := os.Stat(cfg.OpenTimesFile)
+		if os.IsNotExist(err) {
+			openTimesMutex.Lock()
+			cleared := len(openTimes) > 0
+			openTimes = make(map[string]int)
+			openTimesModTime = time.Time{}
+			openTimesMutex.Unlock()
+			if cleared {
+				fmt.Println("Open times file removed - open times cleared")
+			}
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		openTimesMutex.Lock()
+		changed := !info.ModTime().Equal(openTimesModTime)
+		openTimesMutex.Unlock()
+		if changed {
+			fmt.Println("Open times file changed - reloading")
+			loadOpenTimes()
+		}
+	}
+}
+
+func maxOpenSecs() int {
+	if cfg.MaxOpenSecs > 0 {
+		return cfg.MaxOpenSecs
+	}
+	return 60
+}
+
+// How long to hold the door open for this member
+func openSecs(member string) int {
+	secs := 0
+	for _, tag := range validTags {
+		if tag.Member == member && tag.OpenSecs > 0 {
+			secs = tag.OpenSecs
+			break
+		}
+	}
+	openTimesMutex.Lock()
+	if s, ok := openTimes[member]; ok {
+		secs = s
+	}
+	openTimesMutex.Unlock()
+
+	if secs == 0 {
+		return cfg.WaitSecs
+	}
+	if secs > maxOpenSecs() {
+		secs = maxOpenSecs()
+	}
+	debugf("Open time for %s is %d seconds\n", member, secs)
+	return secs
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Local override list, for when the backend ACL is wrong and can't be fixed
+// (or reached) in time. "allow" entries let emergency/admin credentials in
+// regardless of the ACL, schedules, anti-passback or PIN; "deny" entries
+// keep revoked credentials out. Deny wins over allow, and both win over the
+// ACL. The file is re-read whenever it changes.
+
+type OverrideEntry struct {
+	Tag     uint64 `yaml:"Tag"`
+	Action  string `yaml:"Action"`  // "allow" or "deny"
+	Member  string `yaml:"Member"`  // Default is the ACL's member for the tag
+	Level   int    `yaml:"Level"`   // For allow entries
+	Expires string `yaml:"Expires"` // "2025-12-31" (to the end of that day) or RFC3339. Empty never expires
+	Note    string `yaml:"Note"`
+
+	expires time.Time
+}
+
+var overrideMutex sync.Mutex
+var overrides []OverrideEntry
+var overrideModTime time.Time
+
+func parseExpiry(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseInLocation("2006-01-02", s, scheduleLocation); err == nil {
+		return d.AddDate(0, 0, 1), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// (Re)read OverrideFile. A bad file leaves the old list in place.
+func loadOverrides() {
+	if cfg.OverrideFile == "" {
+		return
+	}
+	info, err := os.Stat(cfg.OverrideFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println("Error reading override file: ", err)
+		}
+		return
+	}
+	data, err := ioutil.ReadFile(cfg.OverrideFile)
+	if err != nil {
+		fmt.Println("Error reading override file: ", err)
+		return
+	}
+	var entries []OverrideEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		fmt.Println("Error decoding override file: ", err)
+		return
+	}
+
+	var good []OverrideEntry
+	for _, e := range entries {
+		if e.Action != "allow" && e.Action != "deny" {
+			fmt.Printf("Override for tag %d: Action must be \"allow\" or \"deny\"\n", e.Tag)
+			continue
+		}
+		e.expires, err = parseExpiry(e.Expires)
+		if err != nil {
+			fmt.Printf("Override for tag %d: bad Expires \"%s\"\n", e.Tag, e.Expires)
+			continue
+		}
+		good = append(good, e)
+	}
+
+	overrideMutex.Lock()
+	overrides = good
+	overrideModTime = info.ModTime()
+	overrideMutex.Unlock()
+	fmt.Printf("Loaded %d local overrides\n", len(good))
+}
+
+// Watch OverrideFile for changes
+func OverrideWatcher() {
+	if cfg.OverrideFile == "" {
+		return
+	}
+	for {
+		time.Sleep(5 * time.Second)
+		info, err := os.Stat(cfg.OverrideFile)
+		if os.IsNotExist(err) {
+			// Deleted - nothing it allowed stays allowed
+			overrideMutex.Lock()
+			cleared := overrides != nil
+			overrides = nil
+			overrideModTime = time.Time{}
+			overrideMutex.Unlock()
+			if cleared {
+				fmt.Println("Override file removed - overrides cleared")
+			}
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		overrideMutex.Lock()
+		changed := !info.ModTime().Equal(overrideModTime)
+		overrideMutex.Unlock()
+		if changed {
+			fmt.Println("Override file changed - reloading")
+			loadOverrides()
+		}
+	}
+}
+
+// Does an unexpired deny entry cover this member? For remote opens, which
+// name a member rather than a tag.
+func overrideDeniesMember(member string) bool {
+	overrideMutex.Lock()
+	defer overrideMutex.Unlock()
+	for _, e := range overrides {
+		if e.Action != "deny" || (!e.expires.IsZero() && time.Now().After(e.expires)) {
+			continue
+		}
+		if e.Member == member {
+			return true
+		}
+		for _, t := range validTags {
+			if t.Tag == e.Tag && t.Member == member {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The ACL entry a local override makes for this tag, if there is one
+func overrideTag(id uint64) (ACLlist, bool) {
+	overrideMutex.Lock()
+	var hit *OverrideEntry
+	for i := range overrides {
+		e := &overrides[i]
+		if e.Tag != id || (!e.expires.IsZero() && time.Now().After(e.expires)) {
+			continue
+		}
+		if hit == nil || e.Action == "deny" {
+			hit = e
+		}
+	}
+	var entry OverrideEntry
+	if hit != nil {
+		entry = *hit
+	}
+	overrideMutex.Unlock()
+	if hit == nil {
+		return ACLlist{}, false
+	}
+
+	tag := ACLlist{Tag: id, Member: "override"}
+	for _, t := range validTags {
+		if t.Tag == id {
+			tag = t
+			break
+		}
+	}
+	if entry.Member != "" {
+		tag.Member = entry.Member
+	}
+	tag.Override = entry.Action
+	tag.Allowed = entry.Action == "allow"
+	if tag.Allowed && entry.Level != 0 {
+		tag.Level = entry.Level
+	}
+	return tag, true
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOverrideDeniesMember(t *testing.T) {
+	validTags = []ACLlist{{Tag: 100, Member: "bob", Allowed: true}, {Tag: 200, Member: "carol", Allowed: true}}
+	overrides = []OverrideEntry{
+		{Tag: 100, Action: "deny"},                 // bob, by his tag
+		{Tag: 999, Action: "deny", Member: "dave"}, // dave, by name
+		{Tag: 200, Action: "allow"},                // allow doesn't deny
+		{Tag: 300, Action: "deny", Member: "erin", expires: time.Now().Add(-time.Hour)},
+	}
+	defer func() {
+		validTags = nil
+		overrides = nil
+	}()
+
+	for member, want := range map[string]bool{"bob": true, "dave": true, "carol": false, "erin": false, "frank": false} {
+		if got := overrideDeniesMember(member); got != want {
+			t.Errorf("%s: got %v, want %v", member, got, want)
+		}
+	}
+}
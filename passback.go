@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Anti-passback for paired in/out readers. A credential that went in must
+// come out before it can go in again (and vice versa). In soft mode a
+// violation is only reported, in hard mode it is denied. State is kept in a
+// file so it survives restarts, and forgotten after ResetSecs.
+
+type PassbackConfig struct {
+	Mode      string `yaml:"Mode"`      // "soft" or "hard"
+	ResetSecs int    `yaml:"ResetSecs"` // Forget a credential's state after this long
+	File      string `yaml:"File"`
+}
+
+// Last pass of one credential
+type PassbackEntry struct {
+	Member    string    `json:"member"`
+	Direction string    `json:"direction"`
+	Time      time.Time `json:"time"`
+}
+
+// Passback violation - off the wire
+type PassbackEvent struct {
+	Member    string `json:"member"`
+	Tag       uint64 `json:"tag"`
+	Reader    string `json:"reader"`
+	Direction string `json:"direction"`
+	Denied    bool   `json:"denied"`
+}
+
+var passbackMutex sync.Mutex
+var passbackState = make(map[string]PassbackEntry) // Keyed by tag number
+
+func passbackFileName() string {
+	if cfg.AntiPassback.File != "" {
+		return cfg.AntiPassback.File
+	}
+	return "passback.json"
+}
+
+func passbackReset() time.Duration {
+	if cfg.AntiPassback.ResetSecs > 0 {
+		return time.Duration(cfg.AntiPassback.ResetSecs) * time.Second
+	}
+	return 12 * time.Hour
+}
+
+func loadPassback() {
+	pc := cfg.AntiPassback
+	if pc == nil {
+		return
+	}
+	if pc.Mode != "soft" && pc.Mode != "hard" {
+		log.Fatalf("AntiPassback Mode must be \"soft\" or \"hard\"")
+	}
+	data, err := ioutil.ReadFile(passbackFileName())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println("Error reading passback file: ", err)
+		}
+		return
+	}
+	passbackMutex.Lock()
+	defer passbackMutex.Unlock()
+	if err := json.Unmarshal(data, &passbackState); err != nil {
+		fmt.Println("Error decoding passback file: ", err)
+	}
+}
+
+// Caller holds passbackMutex
+func savePassback() {
+	data, err := json.Marshal(passbackState)
+	if err != nil {
+		fmt.Println("Error encoding passback state: ", err)
+		return
+	}
+	err = ioutil.WriteFile(passbackFileName()+".tmp", data, 0644)
+	if err == nil {
+		err = os.Rename(passbackFileName()+".tmp", passbackFileName())
+	}
+	if err != nil {
+		fmt.Println("Error writing passback file: ", err)
+	}
+}
+
+// Would this pass break anti-passback? Reports the violation, and returns
+// true if it should be denied.
+func passbackDenies(r *ReaderConfig, tag ACLlist) bool {
+	if cfg.AntiPassback == nil || r.Direction == "" {
+		return false
+	}
+	key := strconv.FormatUint(tag.Tag, 10)
+
+	passbackMutex.Lock()
+	last, ok := passbackState[key]
+	passbackMutex.Unlock()
+	if !ok || time.Since(last.Time) > passbackReset() || last.Direction != r.Direction {
+		return false
+	}
+
+	deny := cfg.AntiPassback.Mode == "hard"
+	fmt.Printf("Passback: %s already went %s at %s\n", tag.Member, last.Direction, last.Time.Format(time.Stamp))
+	message, err := json.Marshal(PassbackEvent{
+		Member:    tag.Member,
+		Tag:       tag.Tag,
+		Reader:    r.Name,
+		Direction: r.Direction,
+		Denied:    deny,
+	})
+	if err == nil {
+		var topic string = fmt.Sprintf("ratt/status/node/%s/passback", cfg.ClientID)
+		client.Publish(topic, 0, false, message)
+	}
+	return deny
+}
+
+// Member granted through a reader - remember which way they went
+func passbackRecord(r *ReaderConfig, tag ACLlist) {
+	if cfg.AntiPassback == nil || r == nil || r.Direction == "" {
+		return
+	}
+	passbackMutex.Lock()
+	defer passbackMutex.Unlock()
+	passbackState[strconv.FormatUint(tag.Tag, 10)] = PassbackEntry{
+		Member:    tag.Member,
+		Direction: r.Direction,
+		Time:      time.Now(),
+	}
+	// Expired entries are as good as gone - don't let the file grow forever
+	for k, e := range passbackState {
+		if time.Since(e.Time) > passbackReset() {
+			delete(passbackState, k)
+		}
+	}
+	savePassback()
+}
+
+// Admin command - clear a member's in/out state. Signed like an open
+// request, with tool name "<OpenToolName>/passback". Member is whose state
+// to clear, or "*" for everyone.
+func PassbackClearCommand(payload []byte) {
+	if cfg.AntiPassback == nil {
+		fmt.Println("Anti-passback not configured")
+		return
+	}
+	if cfg.OpenSecret == "" || cfg.OpenToolName == "" {
+		fmt.Println("No OpenSecret or OpenToolName configured - remote passback clear disabled")
+		return
+	}
+	var request OpenRequest
+	err := json.Unmarshal(payload, &request)
+	if err != nil {
+		fmt.Println("Error decoding JSON:", err)
+		return
+	}
+	err = VerifyRemoteRequest(request, cfg.OpenToolName+"/passback")
+	if err != nil {
+		fmt.Printf("Passback clear verification failed: %s\n", err)
+		return
+	}
+
+	passbackMutex.Lock()
+	defer passbackMutex.Unlock()
+	cleared := 0
+	for k, e := range passbackState {
+		if request.Member == "*" || e.Member == request.Member {
+			delete(passbackState, k)
+			cleared++
+		}
+	}
+	savePassback()
+	fmt.Printf("Cleared passback state for \"%s\" (%d credentials)\n", request.Member, cleared)
+}
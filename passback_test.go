@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPassback(t *testing.T, mode string) (*ReaderConfig, *ReaderConfig, *testClient) {
+	cfg.AntiPassback = &PassbackConfig{Mode: mode, ResetSecs: 3600, File: filepath.Join(t.TempDir(), "passback.json")}
+	passbackState = make(map[string]PassbackEntry)
+	c := useTestClient(t.Cleanup)
+	t.Cleanup(func() {
+		cfg.AntiPassback = nil
+		passbackState = make(map[string]PassbackEntry)
+	})
+	return &ReaderConfig{Name: "entry", Direction: "in"}, &ReaderConfig{Name: "exit", Direction: "out"}, c
+}
+
+func TestPassbackInOut(t *testing.T) {
+	in, out, c := testPassback(t, "hard")
+	bob := ACLlist{Tag: 100, Member: "bob", Allowed: true}
+
+	for i, r := range []*ReaderConfig{in, out, in, out} {
+		if passbackDenies(r, bob) {
+			t.Fatalf("pass %d (%s) denied", i, r.Direction)
+		}
+		passbackRecord(r, bob)
+	}
+	if len(c.messages()) != 0 {
+		t.Errorf("violations reported: %v", c.messages())
+	}
+
+	// State is in the file for a restart
+	passbackState = make(map[string]PassbackEntry)
+	loadPassback()
+	if e := passbackState["100"]; e.Member != "bob" || e.Direction != "out" {
+		t.Errorf("reloaded %+v", passbackState)
+	}
+}
+
+func TestPassbackDoubleEntry(t *testing.T) {
+	for _, mode := range []string{"hard", "soft"} {
+		in, _, c := testPassback(t, mode)
+		bob := ACLlist{Tag: 100, Member: "bob", Allowed: true}
+		alice := ACLlist{Tag: 200, Member: "alice", Allowed: true}
+
+		passbackRecord(in, bob)
+		if denied := passbackDenies(in, bob); denied != (mode == "hard") {
+			t.Errorf("%s: second entry denied %v", mode, denied)
+		}
+		if passbackDenies(in, alice) {
+			t.Errorf("%s: other member denied", mode)
+		}
+		msgs := c.messages()
+		if len(msgs) != 1 || !strings.HasSuffix(msgs[0].topic, "/passback") {
+			t.Fatalf("%s: published %v", mode, msgs)
+		}
+		var ev PassbackEvent
+		json.Unmarshal([]byte(msgs[0].payload), &ev)
+		if ev.Member != "bob" || ev.Direction != "in" || ev.Denied != (mode == "hard") {
+			t.Errorf("%s: event %+v", mode, ev)
+		}
+	}
+
+	// A reader with no direction isn't part of it
+	in, _, _ := testPassback(t, "hard")
+	bob := ACLlist{Tag: 100, Member: "bob", Allowed: true}
+	passbackRecord(in, bob)
+	if passbackDenies(&ReaderConfig{Name: "side"}, bob) {
+		t.Error("undirected reader denied")
+	}
+}
+
+func TestPassbackReset(t *testing.T) {
+	in, _, _ := testPassback(t, "hard")
+	bob := ACLlist{Tag: 100, Member: "bob", Allowed: true}
+
+	// Forgotten after ResetSecs
+	passbackState["100"] = PassbackEntry{Member: "bob", Direction: "in", Time: time.Now().Add(-2 * time.Hour)}
+	if passbackDenies(in, bob) {
+		t.Error("denied after ResetSecs")
+	}
+
+	// Cleared by a signed admin request
+	cfg.OpenSecret = base64.StdEncoding.EncodeToString([]byte("test secret"))
+	cfg.OpenToolName = "frontdoor"
+	defer func() { cfg.OpenSecret, cfg.OpenToolName = "", "" }()
+	clear := func(member string, tool string) {
+		ts := uint64(time.Now().Unix())
+		sig, _, err := SignOpenRequest(cfg.OpenSecret, member, tool, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, _ := json.Marshal(OpenRequest{Member: member, ToolName: tool, Timestamp: ts, Signature: sig})
+		PassbackClearCommand(payload)
+	}
+
+	passbackRecord(in, bob)
+	clear("bob", "frontdoor") // Signed for an open, not a passback clear
+	if !passbackDenies(in, bob) {
+		t.Fatal("cleared by a request for another command")
+	}
+	clear("alice", "frontdoor/passback")
+	if !passbackDenies(in, bob) {
+		t.Error("cleared by a request for another member")
+	}
+	clear("bob", "frontdoor/passback")
+	if passbackDenies(in, bob) {
+		t.Error("still denied after clear")
+	}
+
+	passbackRecord(in, bob)
+	passbackRecord(in, ACLlist{Tag: 200, Member: "alice", Allowed: true})
+	clear("*", "frontdoor/passback")
+	if len(passbackState) != 0 {
+		t.Errorf("left after clear all: %v", passbackState)
+	}
+}
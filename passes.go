@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage pass registry. Every pass printed is recorded (and kept in a file
+// across restarts) until it is closed. Members can only hold so many open
+// passes, and passes coming up on expiry or past it are announced.
+
+type PassRecord struct {
+	ID       string    `json:"id"`
+	Member   string    `json:"member"`
+	Issued   time.Time `json:"issued"`
+	Expires  time.Time `json:"expires"`
+	Location string    `json:"location,omitempty"`
+	Closed   time.Time `json:"closed"`
+
+	Warned       bool      `json:"warned,omitempty"` // Expiry warning sent
+	OverdueNoted time.Time `json:"overdue_noted"`    // Last overdue notice
+}
+
+// Pass status - off the wire. Published for expiry warnings, overdue
+// notices and verify scans.
+type PassStatusEvent struct {
+	Pass     string `json:"pass"`
+	Member   string `json:"member,omitempty"`
+	Status   string `json:"status"` // "valid", "expiring", "overdue", "closed" or "unknown"
+	Expires  string `json:"expires,omitempty"`
+	Location string `json:"location,omitempty"`
+}
+
+// Remote pass close - signed like an open request, with tool name
+// "<OpenToolName>/pass"
+type PassCloseRequest struct {
+	OpenRequest
+	Pass string `json:"pass"`
+}
+
+var passMutex sync.Mutex
+var passes = make(map[string]*PassRecord)
+
+func passFileName() string {
+	if sc := storageConfig(); sc.File != "" {
+		return sc.File
+	}
+	return "passes.json"
+}
+
+func passKeep() time.Duration {
+	if sc := storageConfig(); sc.KeepDays > 0 {
+		return time.Duration(sc.KeepDays) * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+func passWarn() time.Duration {
+	if sc := storageConfig(); sc.WarnHours > 0 {
+		return time.Duration(sc.WarnHours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+func loadPasses() {
+	if cfg.Personality != "storage" {
+		return
+	}
+	data, err := ioutil.ReadFile(passFileName())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println("Error reading pass file: ", err)
+		}
+		return
+	}
+	var records []*PassRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		fmt.Println("Error decoding pass file: ", err)
+		return
+	}
+	passMutex.Lock()
+	defer passMutex.Unlock()
+	for _, p := range records {
+		passes[p.ID] = p
+	}
+}
+
+// Caller holds passMutex
+func savePasses() {
+	records := make([]*PassRecord, 0, len(passes))
+	for _, p := range passes {
+		records = append(records, p)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Issued.Before(records[j].Issued) })
+	data, err := json.MarshalIndent(records, "", " ")
+	if err != nil {
+		fmt.Println("Error encoding passes: ", err)
+		return
+	}
+	err = ioutil.WriteFile(passFileName()+".tmp", data, 0644)
+	if err == nil {
+		err = os.Rename(passFileName()+".tmp", passFileName())
+	}
+	if err != nil {
+		fmt.Println("Error writing pass file: ", err)
+	}
+}
+
+// Does this member already hold as many open passes as they may?
+func passLimitReached(member string) bool {
+	max := storageConfig().MaxActive
+	if max <= 0 {
+		return false
+	}
+	passMutex.Lock()
+	defer passMutex.Unlock()
+	n := 0
+	for _, p := range passes {
+		if p.Member == member && p.Closed.IsZero() {
+			n++
+		}
+	}
+	return n >= max
+}
+
+func recordPass(p *PassRecord) error {
+	passMutex.Lock()
+	defer passMutex.Unlock()
+	if _, ok := passes[p.ID]; ok {
+		return fmt.Errorf("duplicate pass ID %s", p.ID)
+	}
+	passes[p.ID] = p
+	savePasses()
+	return nil
+}
+
+// Caller holds passMutex
+func passStatus(p *PassRecord, now time.Time) string {
+	switch {
+	case !p.Closed.IsZero():
+		return "closed"
+	case now.After(p.Expires):
+		return "overdue"
+	case p.Expires.Sub(now) < passWarn():
+		return "expiring"
+	}
+	return "valid"
+}
+
+func publishPassStatus(event string, ev PassStatusEvent) {
+	message, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Println("Error encoding pass status:", err)
+		return
+	}
+	var topic string = fmt.Sprintf("ratt/status/node/%s/personality/pass/%s", cfg.ClientID, event)
+	client.Publish(topic, 0, false, message)
+}
+
+// Warn about passes about to expire, and keep nagging about overdue ones
+// once a day
+func PassMonitor() {
+	if cfg.Personality != "storage" {
+		return
+	}
+	for {
+		var notices []PassStatusEvent
+		now := time.Now()
+		passMutex.Lock()
+		changed := false
+		for id, p := range passes {
+			if !p.Closed.IsZero() && now.Sub(p.Closed) > passKeep() {
+				delete(passes, id)
+				changed = true
+				continue
+			}
+			status := passStatus(p, now)
+			notice := false
+			if status == "expiring" && !p.Warned {
+				p.Warned = true
+				notice = true
+			} else if status == "overdue" && now.Sub(p.OverdueNoted) >= 24*time.Hour {
+				p.OverdueNoted = now
+				notice = true
+			}
+			if notice {
+				changed = true
+				notices = append(notices, PassStatusEvent{Pass: p.ID, Member: p.Member, Status: status,
+					Expires: p.Expires.Format("2006-01-02"), Location: p.Location})
+			}
+		}
+		if changed {
+			savePasses()
+		}
+		passMutex.Unlock()
+
+		for _, ev := range notices {
+			fmt.Printf("Storage pass %s for %s is %s\n", ev.Pass, ev.Member, ev.Status)
+			publishPassStatus(ev.Status, ev)
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// Pass barcode scanned in verify mode - show what we know about it
+func VerifyPass(id string) {
+	id = strings.ToUpper(strings.Trim(id, "*"))
+	ev := PassStatusEvent{Pass: id, Status: "unknown"}
+	passMutex.Lock()
+	if p, ok := passes[id]; ok {
+		ev = PassStatusEvent{Pass: p.ID, Member: p.Member, Status: passStatus(p, time.Now()),
+			Expires: p.Expires.Format("2006-01-02"), Location: p.Location}
+	}
+	passMutex.Unlock()
+
+	fmt.Printf("Storage pass %s: %s (member %s, expires %s)\n", ev.Pass, ev.Status, ev.Member, ev.Expires)
+	publishPassStatus("verify", ev)
+	switch ev.Status {
+	case "valid":
+		ledShow("granted", 3*time.Second)
+		time.Sleep(3 * time.Second)
+	case "expiring":
+		accessDenied("timeout-warning")
+	default:
+		accessDenied("denied")
+	}
+}
+
+// Admin command - close a pass (the member cleared out their storage)
+func PassCloseCommand(payload []byte) {
+	if cfg.OpenSecret == "" || cfg.OpenToolName == "" {
+		fmt.Println("No OpenSecret or OpenToolName configured - remote pass close disabled")
+		return
+	}
+	var request PassCloseRequest
+	err := json.Unmarshal(payload, &request)
+	if err != nil {
+		fmt.Println("Error decoding JSON:", err)
+		return
+	}
+	// The pass ID is signed too, so a captured request can't close another pass
+	id := strings.ToUpper(request.Pass)
+	err = VerifyRemoteRequest(request.OpenRequest, cfg.OpenToolName+"/pass/"+id)
+	if err != nil {
+		fmt.Printf("Pass close verification failed: %s\n", err)
+		return
+	}
+
+	passMutex.Lock()
+	defer passMutex.Unlock()
+	p, ok := passes[id]
+	if !ok {
+		fmt.Printf("Pass close: no pass \"%s\"\n", request.Pass)
+		return
+	}
+	if p.Closed.IsZero() {
+		p.Closed = time.Now()
+		savePasses()
+	}
+	fmt.Printf("Storage pass %s for %s closed by %s\n", p.ID, p.Member, request.Member)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kenshaw/evdev"
+	"golang.org/x/crypto/bcrypt"
+	"goratt/wiegland"
+)
+
+// Badge + PIN mode. A granted badge arms a PIN entry window; digits come
+// from an evdev keypad (PinDevice) or from Wiegand keypad frames, and
+// are checked against the member's bcrypt PIN hash from the ACL. Each
+// reader has its own entry, and only its own keypad types into it.
+
+type pinEntry struct {
+	reader *ReaderConfig
+	tag    ACLlist
+	digits string
+	timer  *time.Timer
+}
+
+var pinMutex sync.Mutex
+var pinPending = make(map[*ReaderConfig]*pinEntry)
+var pinFailures = make(map[string][]time.Time)
+
+// PinHash is how the backend stores PINs: bcrypt, with its own salt in
+// every hash
+func PinHash(pin string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func VerifyPin(pinHash string, pin string) bool {
+	if !strings.HasPrefix(pinHash, "$2") {
+		// Old unsalted SHA256 - too easy to brute force from the tag file
+		fmt.Println("PIN hash is not bcrypt - not accepted")
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(pinHash), []byte(pin)) == nil
+}
+
+func pinTimeout() time.Duration {
+	if cfg.PinTimeout > 0 {
+		return time.Duration(cfg.PinTimeout) * time.Second
+	}
+	return 15 * time.Second
+}
+
+// Too many wrong PINs inside the lockout window? Caller holds pinMutex.
+func pinLockedOut(member string) bool {
+	maxAttempts := cfg.PinMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	window := time.Duration(cfg.PinLockoutSecs) * time.Second
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+
+	recent := pinFailures[member][:0]
+	for _, t := range pinFailures[member] {
+		if time.Since(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) == 0 {
+		delete(pinFailures, member)
+		return false
+	}
+	pinFailures[member] = recent
+	return len(recent) >= maxAttempts
+}
+
+// Count a wrong PIN towards the lockout, or clear the count on a right one
+func pinResult(member string, ok bool) {
+	pinMutex.Lock()
+	defer pinMutex.Unlock()
+	if ok {
+		delete(pinFailures, member)
+	} else {
+		pinFailures[member] = append(pinFailures[member], time.Now())
+	}
+}
+
+// Granted badge - wait for the member's PIN
+func RequestPin(r *ReaderConfig, tag ACLlist) {
+	if tag.PinHash == "" {
+		fmt.Printf("Member %s has no PIN\n", tag.Member)
+		publishAccess(r, 0, tag.Member, "nopin")
+		accessDenied("denied")
+		return
+	}
+
+	pinMutex.Lock()
+	if pinLockedOut(tag.Member) {
+		pinMutex.Unlock()
+		fmt.Printf("Member %s locked out for wrong PINs\n", tag.Member)
+		publishAccess(r, 0, tag.Member, "pinlockout")
+		accessDenied("denied")
+		return
+	}
+	if old := pinPending[r]; old != nil {
+		old.timer.Stop()
+	}
+	p := &pinEntry{reader: r, tag: tag}
+	p.timer = time.AfterFunc(pinTimeout(), func() { pinExpire(p) })
+	pinPending[r] = p
+	pinMutex.Unlock()
+
+	ledShow("pinwait", pinTimeout())
+}
+
+func pinExpire(p *pinEntry) {
+	pinMutex.Lock()
+	if pinPending[p.reader] != p {
+		pinMutex.Unlock()
+		return
+	}
+	delete(pinPending, p.reader)
+	pinMutex.Unlock()
+
+	fmt.Printf("PIN timeout for %s\n", p.tag.Member)
+	publishAccess(p.reader, 0, p.tag.Member, "pintimeout")
+	ledEnd("pinwait")
+}
+
+// One keypad press on reader r - 0-9, * (clear) or # (enter)
+func KeypadKey(r *ReaderConfig, key byte) {
+	pinMutex.Lock()
+	p := pinPending[r]
+	if p == nil {
+		pinMutex.Unlock()
+		fmt.Println("Keypress with no PIN pending on", r.Name)
+		return
+	}
+	switch {
+	case key <= 9:
+		p.digits += string(rune('0' + key))
+	case key == wiegland.KeyStar:
+		p.digits = ""
+	case key == wiegland.KeyPound:
+		delete(pinPending, r)
+		p.timer.Stop()
+		pinMutex.Unlock()
+		checkPin(p)
+		return
+	}
+	pinMutex.Unlock()
+}
+
+// Map a USB keypad key onto the Wiegand keypad values
+func KeypadEvdevKey(r *ReaderConfig, k evdev.KeyType) {
+	switch k {
+	case evdev.KeyEnter, evdev.KeyKeypadEnter:
+		KeypadKey(r, wiegland.KeyPound)
+	case evdev.KeyEscape, evdev.KeyBackSpace, evdev.KeyKeypadAsterisk:
+		KeypadKey(r, wiegland.KeyStar)
+	default:
+		s := strings.TrimPrefix(k.String(), "Keypad")
+		if len(s) == 1 && s[0] >= '0' && s[0] <= '9' {
+			KeypadKey(r, s[0]-'0')
+		}
+	}
+}
+
+func checkPin(p *pinEntry) {
+	member := p.tag.Member
+
+	pinMutex.Lock()
+	locked := pinLockedOut(member)
+	pinMutex.Unlock()
+	if locked {
+		fmt.Printf("Member %s locked out for wrong PINs\n", member)
+		publishAccess(p.reader, 0, member, "pinlockout")
+		accessDenied("denied")
+		return
+	}
+	// bcrypt is slow on purpose - don't hold pinMutex for it
+	ok := VerifyPin(p.tag.PinHash, p.digits)
+	pinResult(member, ok)
+
+	if !ok {
+		fmt.Printf("Wrong PIN for %s\n", member)
+		publishAccess(p.reader, 0, member, "badpin")
+		accessDenied("denied")
+		return
+	}
+
+	fmt.Printf("PIN ok for %s\n", member)
+	ledEnd("pinwait")
+	grantAccess(p.reader, p.tag)
+}
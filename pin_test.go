@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func lockedOut(member string) bool {
+	pinMutex.Lock()
+	defer pinMutex.Unlock()
+	return pinLockedOut(member)
+}
+
+func TestPinLockout(t *testing.T) {
+	cfg.PinMaxAttempts = 3
+	cfg.PinLockoutSecs = 60
+	defer func() {
+		cfg.PinMaxAttempts = 0
+		cfg.PinLockoutSecs = 0
+		pinFailures = make(map[string][]time.Time)
+	}()
+
+	old := -61 * time.Second
+	tests := []struct {
+		name    string
+		earlier []time.Duration // Ages of failures already recorded
+		results []bool          // Then these PIN checks
+		locked  bool
+	}{
+		{"none", nil, nil, false},
+		{"two wrong", nil, []bool{false, false}, false},
+		{"three wrong", nil, []bool{false, false, false}, true},
+		{"four wrong", nil, []bool{false, false, false, false}, true},
+		{"right resets", nil, []bool{false, false, true, false, false}, false},
+		{"right after lockout", nil, []bool{false, false, false, true}, false},
+		{"expired", []time.Duration{old, old, old}, nil, false},
+		{"expired don't count", []time.Duration{old, old}, []bool{false, false}, false},
+		{"old and new", []time.Duration{old, -30 * time.Second}, []bool{false, false}, true},
+	}
+	for _, tt := range tests {
+		pinFailures = make(map[string][]time.Time)
+		for _, age := range tt.earlier {
+			pinFailures["bob"] = append(pinFailures["bob"], time.Now().Add(age))
+		}
+		for _, ok := range tt.results {
+			pinResult("bob", ok)
+		}
+		if got := lockedOut("bob"); got != tt.locked {
+			t.Errorf("%s: locked out %v, want %v", tt.name, got, tt.locked)
+		}
+		if lockedOut("alice") {
+			t.Errorf("%s: another member locked out", tt.name)
+		}
+		if !tt.locked && len(tt.results) == 0 {
+			if _, ok := pinFailures["bob"]; ok {
+				t.Errorf("%s: expired failures not pruned", tt.name)
+			}
+		}
+	}
+}
+
+func TestVerifyPin(t *testing.T) {
+	hash, err := PinHash("4321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyPin(hash, "4321") || VerifyPin(hash, "1234") || VerifyPin(hash, "") {
+		t.Error("bcrypt PIN check wrong")
+	}
+	// Unsalted SHA256 of "4321" is never accepted
+	if VerifyPin("fe2592b42a727e977f055947385b709cc82b16b9a87f88c6abf3900d65d0cdc3", "4321") {
+		t.Error("SHA256 hash accepted")
+	}
+}
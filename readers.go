@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var readers []*ReaderConfig
+
+// One lock per door pin, so an inside and an outside reader on the same
+// door don't drive it at the same time
+var doorLocks = make(map[int]*sync.Mutex)
+var doorLocksMutex sync.Mutex
+
+// Readers from the config, or the single legacy NFCdevice reader
+func configuredReaders() []*ReaderConfig {
+	if readers != nil {
+		return readers
+	}
+	if len(cfg.Readers) == 0 {
+		readers = append(readers, &ReaderConfig{
+			Name:      "default",
+			Mode:      cfg.NFCmode,
+			Device:    cfg.NFCdevice,
+			DoorPin:   cfg.DoorPin,
+			DoorMode:  cfg.Mode,
+			PinDevice: cfg.PinDevice,
+		})
+		if err := checkServoPins(readers); err != nil {
+			log.Fatal(err)
+		}
+		return readers
+	}
+	if cfg.PinDevice != "" && len(cfg.Readers) > 1 {
+		log.Fatal("PinDevice with several Readers must be set on each reader")
+	}
+
+	for i := range cfg.Readers {
+		r := &cfg.Readers[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("reader%d", i)
+		}
+		if r.Device == "" {
+			log.Fatalf("Reader %s has no Device", r.Name)
+		}
+		if r.Direction != "" && r.Direction != "in" && r.Direction != "out" {
+			log.Fatalf("Reader %s Direction must be \"in\" or \"out\"", r.Name)
+		}
+		if r.DoorPin == nil {
+			r.DoorPin = cfg.DoorPin
+		}
+		if r.DoorMode == "" {
+			r.DoorMode = cfg.Mode
+		}
+		if r.PinDevice == "" {
+			r.PinDevice = cfg.PinDevice
+		}
+		readers = append(readers, r)
+	}
+	if err := checkServoPins(readers); err != nil {
+		log.Fatal(err)
+	}
+	return readers
+}
+
+func doorLock(pin *int) *sync.Mutex {
+	doorLocksMutex.Lock()
+	defer doorLocksMutex.Unlock()
+	key := -1
+	if pin != nil {
+		key = *pin
+	}
+	l, ok := doorLocks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		doorLocks[key] = l
+	}
+	return l
+}
+
+// Open the door this reader controls for secs, then close it
+func openDoor(r *ReaderConfig, secs int) {
+	l := doorLock(r.DoorPin)
+	l.Lock()
+	defer l.Unlock()
+	open_servo(r.DoorPin, cfg.ServoOpen, cfg.ServoClose, secs, r.DoorMode)
+}
+
+// Home servo doors to closed at startup - nothing knows where they were left
+func homeDoors() {
+	done := make(map[int]bool)
+	for _, r := range configuredReaders() {
+		if r.DoorMode != "servo" || r.DoorPin == nil || done[*r.DoorPin] {
+			continue
+		}
+		done[*r.DoorPin] = true
+		servo_reset(r.DoorPin, false)
+	}
+}
+
+func (r *ReaderConfig) debounceWindow() time.Duration {
+	secs := cfg.DebounceSecs
+	if r.DebounceSecs != 0 {
+		secs = r.DebounceSecs
+	}
+	if secs == 0 {
+		secs = 3
+	}
+	if secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// Same credential on this reader inside the debounce window? Every read
+// restarts the window, so a card held on the reader stays suppressed.
+// A different credential always gets through.
+func (r *ReaderConfig) duplicate(id uint64) bool {
+	r.seenMutex.Lock()
+	defer r.seenMutex.Unlock()
+	dup := id == r.lastTag && time.Since(r.lastSeen) < r.debounceWindow()
+	r.lastTag = id
+	r.lastSeen = time.Now()
+	return dup
+}
+
+// Restart the window once a swipe has been handled, as the door may have
+// been open for a while and frames will have queued up
+func (r *ReaderConfig) markSeen(id uint64) {
+	r.seenMutex.Lock()
+	defer r.seenMutex.Unlock()
+	if r.lastTag == id {
+		r.lastSeen = time.Now()
+	}
+}
+
+// Frame layout for serial readers: the reader's own, the node's, or the
+// original USB reader's
+func (r *ReaderConfig) frameSpec() *FrameSpec {
+	spec := defaultFrameSpec
+	if r.SerialFrame != nil {
+		spec = *r.SerialFrame
+	} else if cfg.SerialFrame != nil {
+		spec = *cfg.SerialFrame
+	}
+	if err := spec.init(); err != nil {
+		log.Fatalf("Reader %s SerialFrame: %v", r.Name, err)
+	}
+	return &spec
+}
+
+// Member granted on this reader - start a tool session, or open the door
+// unless it is already held open by an unlock schedule
+func admitMember(r *ReaderConfig, tag ACLlist) {
+	// A grant that was pending (PIN, second person) when the e-stop hit
+	if estopActive() {
+		fmt.Printf("Emergency stop latched - not admitting %s\n", tag.Member)
+		return
+	}
+	passbackRecord(r, tag)
+	if cfg.Personality == "tool" {
+		ToolGrant(r, tag)
+		return
+	}
+	if cfg.Personality == "storage" {
+		IssuePass(r, tag)
+		return
+	}
+	FirstPersonIn(tag)
+	if doorHeld(r.DoorPin) {
+		fmt.Println("Door already unlocked")
+		return
+	}
+	openDoor(r, openSecs(tag.Member))
+}
+
+// Member authorized on reader r - apply any two-person rule, then publish
+// the grant and let them in
+func grantAccess(r *ReaderConfig, tag ACLlist) {
+	ev := AccessEvent{Allowed: 1, Member: tag.Member, Override: tag.Override}
+	if tag.trainer != "" {
+		ev.Reason = "training"
+		ev.Trainer = tag.trainer
+	}
+	if cfg.TwoPersonSecs > 0 {
+		first, ok := twoPersonCheck(r, tag)
+		if !ok {
+			return
+		}
+		ev.Members = []string{first.Member, tag.Member}
+	}
+	publishAccessEvent(r, ev)
+	trainerGranted(tag)
+	admitMember(r, tag)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuplicateRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		debounce int
+		last     uint64
+		age      time.Duration // Since the last read
+		id       uint64
+		dup      bool
+	}{
+		{"first read", 3, 0, time.Hour, 100, false},
+		{"same tag inside window", 3, 100, time.Second, 100, true},
+		{"same tag after window", 3, 100, 4 * time.Second, 100, false},
+		{"other tag inside window", 3, 100, time.Second, 200, false},
+		{"default window", 0, 100, 2 * time.Second, 100, true},
+		{"after default window", 0, 100, 3 * time.Second, 100, false},
+		{"debounce off", -1, 100, 0, 100, false},
+	}
+	for _, tt := range tests {
+		r := &ReaderConfig{Name: "test", DebounceSecs: tt.debounce, lastTag: tt.last, lastSeen: time.Now().Add(-tt.age)}
+		if got := r.duplicate(tt.id); got != tt.dup {
+			t.Errorf("%s: duplicate %v, want %v", tt.name, got, tt.dup)
+		}
+	}
+}
+
+func TestDuplicateHeldCard(t *testing.T) {
+	r := &ReaderConfig{Name: "test", DebounceSecs: 3}
+	if r.duplicate(100) {
+		t.Fatal("first read dropped")
+	}
+	// A card held on the reader keeps restarting the window
+	for i := 0; i < 3; i++ {
+		r.lastSeen = r.lastSeen.Add(-2 * time.Second)
+		if !r.duplicate(100) {
+			t.Fatalf("held card read %d accepted", i)
+		}
+	}
+
+	// The door was open a while - markSeen restarts the window after
+	r.lastSeen = time.Now().Add(-10 * time.Second)
+	r.markSeen(100)
+	if !r.duplicate(100) {
+		t.Error("frame queued during the open accepted")
+	}
+	r.lastSeen = time.Now().Add(-10 * time.Second)
+	r.markSeen(200) // Not the last tag - no effect
+	if r.duplicate(100) {
+		t.Error("read after the window dropped")
+	}
+}
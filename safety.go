@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hjkoskel/govattu"
+)
+
+// Safety inputs. An emergency stop drops the tool enable output at once and
+// latches - nothing is granted until the stop is released and reset. A fire
+// alarm holds the FireDoors open for egress until it clears. Both come ahead
+// of anything else a badge would do.
+
+type SafetyConfig struct {
+	EstopPin      *uint8 `yaml:"EstopPin"`
+	EstopResetPin *uint8 `yaml:"EstopResetPin"` // Button to clear a latched stop
+	FirePin       *uint8 `yaml:"FirePin"`
+	ActiveHigh    bool   `yaml:"ActiveHigh"` // Default is active low, contact to ground
+
+	EstopNormallyClosed bool     `yaml:"EstopNormallyClosed"` // Active when the contact opens (or the wire is cut)
+	FireNormallyClosed  bool     `yaml:"FireNormallyClosed"`
+	FireDoors           []string `yaml:"FireDoors"` // Readers whose doors to release. Empty is all
+}
+
+var safetyMutex sync.Mutex
+var estopLatched bool
+var fireActive bool
+var estopPressed bool // Input state, as last polled
+
+// Check the safety config at startup
+func loadSafety() {
+	sc := cfg.Safety
+	if sc == nil {
+		return
+	}
+	names := make(map[string]bool)
+	for _, r := range configuredReaders() {
+		names[r.Name] = true
+	}
+	for _, n := range sc.FireDoors {
+		if !names[n] {
+			log.Fatalf("FireDoors has unknown reader \"%s\"", n)
+		}
+	}
+	if sc.FirePin != nil && cfg.Personality == "tool" && len(sc.FireDoors) == 0 {
+		log.Fatal("FirePin with Personality: tool needs FireDoors")
+	}
+}
+
+func estopActive() bool {
+	safetyMutex.Lock()
+	defer safetyMutex.Unlock()
+	return estopLatched
+}
+
+func fireAlarmActive() bool {
+	safetyMutex.Lock()
+	defer safetyMutex.Unlock()
+	return fireActive
+}
+
+// Is the door on this pin held open by the fire alarm?
+func fireHoldsPin(pin *int) bool {
+	if pin == nil || cfg.Safety == nil || !fireAlarmActive() {
+		return false
+	}
+	if len(cfg.Safety.FireDoors) == 0 {
+		return true
+	}
+	for _, r := range configuredReaders() {
+		if r.DoorPin == nil || *r.DoorPin != *pin {
+			continue
+		}
+		for _, n := range cfg.Safety.FireDoors {
+			if n == r.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// E-stop pressed - kill the tool and latch
+func tripEstop() {
+	safetyMutex.Lock()
+	if estopLatched {
+		safetyMutex.Unlock()
+		return
+	}
+	estopLatched = true
+	safetyMutex.Unlock()
+
+	fmt.Println("EMERGENCY STOP")
+	toolMutex.Lock()
+	s := session
+	toolMutex.Unlock()
+	if s != nil {
+		endSession(s, "estop")
+	}
+	if cfg.Personality == "tool" {
+		// Whether or not there was a session, make sure every output is off
+		for _, r := range configuredReaders() {
+			setToolEnable(r, false)
+		}
+	}
+	publishAlarm(AlarmEvent{Alarm: "estop", Active: true})
+	ledRefresh()
+	soundPlay("alarm")
+}
+
+func resetEstop(why string) {
+	safetyMutex.Lock()
+	if !estopLatched {
+		safetyMutex.Unlock()
+		return
+	}
+	estopLatched = false
+	safetyMutex.Unlock()
+
+	fmt.Printf("Emergency stop reset (%s)\n", why)
+	publishAlarm(AlarmEvent{Alarm: "estop", Active: false, Detail: why})
+	ledRefresh()
+}
+
+func setFire(active bool) {
+	safetyMutex.Lock()
+	changed := fireActive != active
+	fireActive = active
+	safetyMutex.Unlock()
+	if !changed {
+		return
+	}
+
+	if active {
+		fmt.Println("FIRE ALARM - releasing doors")
+	} else {
+		fmt.Println("Fire alarm cleared")
+	}
+	publishAlarm(AlarmEvent{Alarm: "fire", Active: active})
+	updateUnlock()
+	ledRefresh()
+	if active {
+		soundPlay("alarm")
+	}
+}
+
+// Safety blocks this swipe? Called before anything else in BadgeTag.
+func safetyBlocks(r *ReaderConfig, id uint64) bool {
+	if !estopActive() {
+		return false
+	}
+	member := ""
+	if tag, ok := lookupTag(id); ok {
+		member = tag.Member
+	}
+	fmt.Printf("Emergency stop latched - ignoring tag %d on %s\n", id, r.Name)
+	publishAccess(r, 0, member, "estop")
+	return true
+}
+
+// Remote e-stop reset. Signed like an open request, with tool name
+// "<OpenToolName>/estop".
+func EstopResetCommand(payload []byte) {
+	if cfg.OpenSecret == "" || cfg.OpenToolName == "" {
+		fmt.Println("No OpenSecret or OpenToolName configured - remote e-stop reset disabled")
+		return
+	}
+	var request OpenRequest
+	err := json.Unmarshal(payload, &request)
+	if err != nil {
+		fmt.Println("Error decoding JSON:", err)
+		return
+	}
+	err = VerifyRemoteRequest(request, cfg.OpenToolName+"/estop")
+	if err != nil {
+		fmt.Printf("E-stop reset verification failed: %s\n", err)
+		return
+	}
+	safetyMutex.Lock()
+	pressed := estopPressed
+	safetyMutex.Unlock()
+	if pressed {
+		fmt.Println("E-stop still pressed - not resetting")
+		return
+	}
+	resetEstop("remote " + request.Member)
+}
+
+// Is this input active? A normally closed input is active when its
+// contact opens, so a cut wire reads as active too.
+func safetyInput(hw govattu.Vattu, pin uint8, nc bool) bool {
+	return hw.ReadPinLevel(pin) == (cfg.Safety.ActiveHigh != nc)
+}
+
+// Poll the safety inputs. The e-stop and fire inputs each get their own
+// goroutine, as a fire alarm waits on doors that may be part way through
+// opening, and that mustn't hold up seeing an e-stop.
+func SafetyMonitor() {
+	sc := cfg.Safety
+	if sc == nil || (sc.EstopPin == nil && sc.FirePin == nil) {
+		return
+	}
+	hw, err := govattu.Open()
+	if err != nil {
+		log.Fatal("Safety inputs: ", err)
+	}
+	defer hw.Close()
+
+	for _, pin := range []*uint8{sc.EstopPin, sc.EstopResetPin, sc.FirePin} {
+		if pin == nil {
+			continue
+		}
+		hw.PinMode(*pin, govattu.ALTinput)
+		if sc.ActiveHigh {
+			hw.PullMode(*pin, govattu.PULLdown)
+		} else {
+			hw.PullMode(*pin, govattu.PULLup)
+		}
+	}
+
+	if sc.FirePin != nil {
+		go func() {
+			for {
+				setFire(safetyInput(hw, *sc.FirePin, sc.FireNormallyClosed))
+				time.Sleep(50 * time.Millisecond)
+			}
+		}()
+	}
+	if sc.EstopPin == nil {
+		select {} // Keep hw open for the fire input
+	}
+	for {
+		pressed := safetyInput(hw, *sc.EstopPin, sc.EstopNormallyClosed)
+		safetyMutex.Lock()
+		estopPressed = pressed
+		safetyMutex.Unlock()
+		if pressed {
+			tripEstop()
+		} else if sc.EstopResetPin != nil && safetyInput(hw, *sc.EstopResetPin, false) {
+			resetEstop("button")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Time-of-day access by ACL level. Levels with no schedule mapped are
+// allowed at any time.
+
+type TimeWindow struct {
+	Days  []string `yaml:"Days"`  // "Mon", "Tue"... or ranges like "Mon-Fri". Empty is every day
+	Start string   `yaml:"Start"` // "09:00"
+	End   string   `yaml:"End"`   // "21:00", "24:00". Before Start wraps past midnight
+
+	days  [7]bool
+	start int // Minutes since midnight
+	end   int
+}
+
+type Schedule struct {
+	Windows  []TimeWindow `yaml:"Windows"`
+	Holidays bool         `yaml:"Holidays"` // Windows apply on holidays too
+}
+
+type ScheduleConfig struct {
+	Timezone  string              `yaml:"Timezone"`
+	Holidays  []string            `yaml:"Holidays"` // "2025-12-25"
+	Schedules map[string]Schedule `yaml:"Schedules"`
+	Levels    map[int]string      `yaml:"Levels"` // ACL level -> schedule name
+}
+
+var scheduleLocation = time.Local
+var holidays = make(map[string]bool)
+
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func parseDay(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, d := range dayNames {
+		if strings.HasPrefix(s, d) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", s)
+}
+
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("bad time %q", s)
+	}
+	if h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("bad time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func (w *TimeWindow) init() error {
+	var err error
+	if w.start, err = parseClock(w.Start); err != nil {
+		return err
+	}
+	if w.end, err = parseClock(w.End); err != nil {
+		return err
+	}
+	if len(w.Days) == 0 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	}
+	for _, d := range w.Days {
+		from, to := d, d
+		if i := strings.Index(d, "-"); i >= 0 {
+			from, to = d[:i], d[i+1:]
+		}
+		f, err := parseDay(from)
+		if err != nil {
+			return err
+		}
+		t, err := parseDay(to)
+		if err != nil {
+			return err
+		}
+		for i := f; ; i = (i + 1) % 7 {
+			w.days[i] = true
+			if i == t {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Is t inside this window?
+func (w *TimeWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	today := int(t.Weekday())
+	if w.end > w.start {
+		return w.days[today] && minute >= w.start && minute < w.end
+	}
+	// Wraps past midnight - Days is the day it starts on
+	yesterday := (today + 6) % 7
+	return (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+// Date (YYYY-MM-DD) the window containing t started on
+func (w *TimeWindow) startDate(t time.Time) string {
+	minute := t.Hour()*60 + t.Minute()
+	if w.end <= w.start && minute < w.end {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t.Format("2006-01-02")
+}
+
+// Is t inside this window, skipping it if it started on a holiday? A window
+// that wraps past midnight belongs to the day it started, so the holiday
+// check goes by that date, not t's.
+func (w *TimeWindow) activeAt(t time.Time, skipHolidays bool) bool {
+	if !w.contains(t) {
+		return false
+	}
+	return !skipHolidays || !holidays[w.startDate(t)]
+}
+
+// Check and prepare the schedule config at startup
+func loadSchedules() {
+	sc := cfg.AccessSchedules
+	if sc == nil {
+		return
+	}
+	if sc.Timezone != "" {
+		loc, err := time.LoadLocation(sc.Timezone)
+		if err != nil {
+			log.Fatal("Bad schedule Timezone: ", err)
+		}
+		scheduleLocation = loc
+	}
+	for _, h := range sc.Holidays {
+		if _, err := time.Parse("2006-01-02", h); err != nil {
+			log.Fatalf("Bad holiday %q: %v", h, err)
+		}
+		holidays[h] = true
+	}
+	for name, s := range sc.Schedules {
+		for i := range s.Windows {
+			if err := s.Windows[i].init(); err != nil {
+				log.Fatalf("Schedule %s: %v", name, err)
+			}
+		}
+	}
+	for level, name := range sc.Levels {
+		if _, ok := sc.Schedules[name]; !ok {
+			log.Fatalf("Level %d has unknown schedule %q", level, name)
+		}
+	}
+}
+
+func (s *Schedule) allows(t time.Time) bool {
+	t = t.In(scheduleLocation)
+	for i := range s.Windows {
+		if s.Windows[i].activeAt(t, !s.Holidays) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is this member - authorized, or a trainee - outside their level's
+// schedule? Local override allows are for emergencies and skip it.
+func scheduleDenies(tag ACLlist, t time.Time) bool {
+	return tag.admitted() && tag.Override == "" && !scheduleAllows(tag.Level, t)
+}
+
+// May a member at this level get in at time t?
+func scheduleAllows(level int, t time.Time) bool {
+	sc := cfg.AccessSchedules
+	if sc == nil {
+		return true
+	}
+	name, ok := sc.Levels[level]
+	if !ok {
+		return true
+	}
+	s := sc.Schedules[name]
+	return s.allows(t)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleHolidayOvernight(t *testing.T) {
+	scheduleLocation = time.UTC
+	holidays = map[string]bool{"2025-12-25": true} // A Thursday
+	defer func() {
+		scheduleLocation = time.Local
+		holidays = make(map[string]bool)
+	}()
+
+	s := Schedule{Windows: []TimeWindow{
+		{Days: []string{"Wed"}, Start: "22:00", End: "02:00"},
+		{Days: []string{"Thu"}, Start: "22:00", End: "02:00"},
+	}}
+	for i := range s.Windows {
+		if err := s.Windows[i].init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := func(day int, hour int) time.Time {
+		return time.Date(2025, 12, day, hour, 30, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(24, 23), true},  // Wednesday's window
+		{at(25, 1), true},   // Still Wednesday's, though it is now the holiday
+		{at(25, 23), false}, // Thursday's window, on the holiday
+		{at(26, 1), false},  // Still Thursday's, though the holiday is over
+		{at(26, 3), false},
+	}
+	for _, tt := range tests {
+		if got := s.allows(tt.t); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.t.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+
+	s.Holidays = true
+	if !s.allows(at(26, 1)) {
+		t.Error("Holidays: true window skipped")
+	}
+}
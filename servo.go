@@ -28,8 +28,9 @@ func door_reset(pos bool) {
 	hw.Close()
 }
 
-func servo_reset(pos int) {
-        if (cfg.DoorPin == nil) {
+// Put the servo straight to ServoOpen or ServoClose, from wherever it is
+func servo_reset(doorPin *int, open bool) {
+        if (doorPin == nil) {
                 return
         }
 	hw, err := govattu.Open()
@@ -37,24 +38,22 @@ func servo_reset(pos int) {
 		panic(err)
 	}
 
-	hw.PinMode(uint8(*cfg.DoorPin), govattu.ALT5)  // ALT5 function for 18 is PWM0
-	hw.PwmSetMode(true, true, false, false)  // PwmSetMode(en0 bool, ms0 bool, en1 bool, ms1 bool) enable and set to mark-space mode for pwm0 and pwm1
+	hw.PinMode(uint8(*doorPin), servoAlt(*doorPin))  // PWM0 function
+	pwmEnable(hw, 0, true)  // Enable pwm0 in mark-space mode, leaving pwm1 (buzzer) alone
 	hw.PwmSetClock(19)  // Set clock divisor to get 50Hz frequency
 	hw.Pwm0SetRange(20000)  // SET RANGE to get 1ms - 2ms pulse width
-	hw.Pwm0Set(uint32(pos))  
-	time.Sleep(5 * time.Second)
+	pos := cfg.ServoClose
+	if (open) { pos = cfg.ServoOpen }
+	hw.Pwm0Set(uint32(pos))
+	time.Sleep(servoSettle())
+	if (servoMotion().Release) { hw.Pwm0Set(0) }
 	hw.Close()
 }
 
 
 func servoFromTo(hw govattu.Vattu, from int, to int) {
-  var inc int = 1
-  if (to < from) { inc = -1 }
-	fmt.Println("From",from,"To",to,"Inc",inc)
-	for i := from; i != to; i += inc  {
-		hw.Pwm0Set(uint32(i))  // Set pwm
-		time.Sleep(2 * time.Millisecond)
-	}
+	fmt.Println("From",from,"To",to)
+	servoMove(hw,from,to)
 }
 
 func servo_holdopen(servoOpen int, servoClose int, waitSecs int, mode string) {
@@ -66,8 +65,8 @@ func servo_holdopen(servoOpen int, servoClose int, waitSecs int, mode string) {
 		panic(err)
 	}
 
-	hw.PinMode(uint8(*cfg.DoorPin), govattu.ALT5)  // ALT5 function for 18 is PWM0
-	hw.PwmSetMode(true, true, false, false)  // PwmSetMode(en0 bool, ms0 bool, en1 bool, ms1 bool) enable and set to mark-space mode for pwm0 and pwm1
+	hw.PinMode(uint8(*cfg.DoorPin), servoAlt(*cfg.DoorPin))  // PWM0 function
+	pwmEnable(hw, 0, true)  // Enable pwm0 in mark-space mode, leaving pwm1 (buzzer) alone
 	hw.PwmSetClock(19)  // Set clock divisor to get 50Hz frequency
 	hw.Pwm0SetRange(20000)  // SET RANGE to get 1ms - 2ms pulse width
 
@@ -81,21 +80,21 @@ func servo_holdopen(servoOpen int, servoClose int, waitSecs int, mode string) {
 		time.Sleep(time.Duration(waitSecs) * time.Second)
 	}
 }
-func open_servo(servoOpen int, servoClose int, waitSecs int, mode string) {
+func open_servo(doorPin *int, servoOpen int, servoClose int, waitSecs int, mode string) {
 	hw, err := govattu.Open()
 	if err != nil {
 		panic(err)
 	}
-    if (cfg.DoorPin != nil) {
+    if (doorPin != nil) {
 
-            hw.PinMode(uint8(*cfg.DoorPin), govattu.ALT5)  // ALT5 function for 18 is PWM0
+            hw.PinMode(uint8(*doorPin), servoAlt(*doorPin))  // PWM0 function
 
             if (mode == "servo") {
-                hw.PwmSetMode(true, true, false, false)  // PwmSetMode(en0 bool, ms0 bool, en1 bool, ms1 bool) enable and set to mark-space mode for pwm0 and pwm1
+                pwmEnable(hw, 0, true)  // Enable pwm0 in mark-space mode, leaving pwm1 (buzzer) alone
                 hw.PwmSetClock(19)  // Set clock divisor to get 50Hz frequency
                 hw.Pwm0SetRange(20000)  // SET RANGE to get 1ms - 2ms pulse width
             } else {
-                hw.PinMode(uint8(*cfg.DoorPin), govattu.ALToutput)  // ALT5 function for 18 is PWM0
+                hw.PinMode(uint8(*doorPin), govattu.ALToutput)  // ALT5 function for 18 is PWM0
             }
 
     }
@@ -104,16 +103,16 @@ func open_servo(servoOpen int, servoClose int, waitSecs int, mode string) {
             hw.PinSet(*cfg.YellowLED)
     }
 	fmt.Println("Servo Opening XX.")
-  LEDwriteString(LEDaccessGranted)
+  ledShow("granted",0)
 
-    if (cfg.DoorPin != nil) {
+    if (doorPin != nil) {
             switch (mode) {
                 case "servo":
                     servoFromTo(hw,servoClose,servoOpen)
                 case "openhigh":
-                    hw.PinSet(uint8(*cfg.DoorPin))
+                    hw.PinSet(uint8(*doorPin))
                 case "openlow":
-                    hw.PinClear(uint8(*cfg.DoorPin))
+                    hw.PinClear(uint8(*doorPin))
             }
     }
 
@@ -125,18 +124,51 @@ func open_servo(servoOpen int, servoClose int, waitSecs int, mode string) {
 	if (cfg.YellowLED != nil) { hw.PinSet(*cfg.YellowLED) }
 
 	fmt.Println("Servo Closing.")
+    if (doorPin != nil) {
 	switch (mode) {
 		case "servo":
 			servoFromTo(hw,servoOpen,servoClose)
 		case "openhigh":
-			hw.PinClear(uint8(*cfg.DoorPin))
+			hw.PinClear(uint8(*doorPin))
 		case "openlow":
-			hw.PinSet(uint8(*cfg.DoorPin))
+			hw.PinSet(uint8(*doorPin))
 		default:
 			panic("Invalid mode in configu file")
 	}
+    }
 	if (cfg.YellowLED != nil) { hw.PinClear(*cfg.YellowLED) }
-    LEDwriteString(LEDidleString) // Set LED to Idle
+    ledEnd("granted") // Set LED to Idle
 	fmt.Println("Servo End.")
 	hw.Close()
 }
+
+// Move the door to open or closed and leave it there (scheduled unlock)
+func set_door(doorPin *int, servoOpen int, servoClose int, mode string, open bool) {
+        if (doorPin == nil) {
+                return
+        }
+	hw, err := govattu.Open()
+	if err != nil {
+		panic(err)
+	}
+	defer hw.Close()
+
+	switch (mode) {
+		case "servo":
+			hw.PinMode(uint8(*doorPin), servoAlt(*doorPin))  // PWM0 function
+			pwmEnable(hw, 0, true)
+			hw.PwmSetClock(19)  // Set clock divisor to get 50Hz frequency
+			hw.Pwm0SetRange(20000)  // SET RANGE to get 1ms - 2ms pulse width
+			if (open) {
+				servoFromTo(hw,servoClose,servoOpen)
+			} else {
+				servoFromTo(hw,servoOpen,servoClose)
+			}
+		case "openhigh":
+			hw.PinMode(uint8(*doorPin), govattu.ALToutput)
+			if (open) { hw.PinSet(uint8(*doorPin)) } else { hw.PinClear(uint8(*doorPin)) }
+		case "openlow":
+			hw.PinMode(uint8(*doorPin), govattu.ALToutput)
+			if (open) { hw.PinClear(uint8(*doorPin)) } else { hw.PinSet(uint8(*doorPin)) }
+	}
+}
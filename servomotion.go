@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hjkoskel/govattu"
+)
+
+// Servo motion profiles. A move runs at Speed, optionally easing in and
+// out, one step per 20ms PWM frame. With Release, the PWM output stops
+// once the servo has settled, so it doesn't sit there buzzing and
+// heating up holding a position nothing is pushing against.
+
+type ServoMotionConfig struct {
+	Speed    int    `yaml:"Speed"`    // Pulse counts (us) per second (Default 500)
+	Ease     string `yaml:"Ease"`     // "linear" (Default), "in", "out" or "in-out"
+	Release  bool   `yaml:"Release"`  // Stop PWM after each move
+	SettleMs int    `yaml:"SettleMs"` // Time to reach position before releasing (Default 500)
+}
+
+const servoFrame = 20 * time.Millisecond
+
+// The servo (PWM0) and a buzzer (PWM1) share one control register, and
+// PwmSetMode writes both channels at once, so the enables are kept here
+var pwmMutex sync.Mutex
+var pwmEnabled [2]bool
+
+// Turn one PWM channel on or off (in mark-space mode) without touching the
+// other
+func pwmEnable(hw govattu.Vattu, channel int, on bool) {
+	pwmMutex.Lock()
+	defer pwmMutex.Unlock()
+	pwmEnabled[channel] = on
+	hw.PwmSetMode(pwmEnabled[0], true, pwmEnabled[1], true)
+}
+
+// PWM0 is ALT0 on GPIO 12 and ALT5 on GPIO 18. Only those two pins can
+// drive a servo - PWM1 is left to the buzzer.
+func servoAlt(pin int) govattu.AltSetting {
+	if pin == 12 {
+		return govattu.ALT0
+	}
+	return govattu.ALT5
+}
+
+// Servo doors must be on PWM0, and all on the same pin. GPIO 12 and 18
+// are the same channel, so servos on both would move together. Readers
+// sharing a door share its pin.
+func checkServoPins(rs []*ReaderConfig) error {
+	var first *ReaderConfig
+	for _, r := range rs {
+		if r.DoorMode != "servo" || r.DoorPin == nil {
+			continue
+		}
+		if *r.DoorPin != 12 && *r.DoorPin != 18 {
+			return fmt.Errorf("reader %s: servo mode needs DoorPin 12 or 18 (PWM0), not %d", r.Name, *r.DoorPin)
+		}
+		if first == nil {
+			first = r
+		} else if *first.DoorPin != *r.DoorPin {
+			return fmt.Errorf("readers %s and %s: servo doors on pins %d and %d would share PWM0", first.Name, r.Name, *first.DoorPin, *r.DoorPin)
+		}
+	}
+	return nil
+}
+
+var servoEases = map[string]func(float64) float64{
+	"linear": func(t float64) float64 { return t },
+	"in":     func(t float64) float64 { return t * t },
+	"out":    func(t float64) float64 { return 1 - (1-t)*(1-t) },
+	"in-out": func(t float64) float64 {
+		if t < 0.5 {
+			return 2 * t * t
+		}
+		return 1 - 2*(1-t)*(1-t)
+	},
+}
+
+func servoMotion() ServoMotionConfig {
+	if cfg.ServoMotion != nil {
+		return *cfg.ServoMotion
+	}
+	return ServoMotionConfig{}
+}
+
+// Check the motion config at startup
+func loadServoMotion() {
+	m := cfg.ServoMotion
+	if m == nil {
+		return
+	}
+	if m.Ease != "" {
+		if _, ok := servoEases[m.Ease]; !ok {
+			log.Fatalf("Unknown ServoMotion Ease \"%s\"", m.Ease)
+		}
+	}
+	if m.Speed < 0 || m.SettleMs < 0 {
+		log.Fatal("ServoMotion Speed and SettleMs can't be negative")
+	}
+}
+
+func servoSettle() time.Duration {
+	if m := servoMotion(); m.SettleMs > 0 {
+		return time.Duration(m.SettleMs) * time.Millisecond
+	}
+	return 500 * time.Millisecond
+}
+
+// Pulse widths for a move, one per frame, ending on to
+func servoSteps(from int, to int) []int {
+	m := servoMotion()
+	speed := m.Speed
+	if speed == 0 {
+		speed = 500
+	}
+	ease := servoEases["linear"]
+	if m.Ease != "" {
+		ease = servoEases[m.Ease]
+	}
+
+	distance := to - from
+	if distance < 0 {
+		distance = -distance
+	}
+	frames := int(time.Duration(distance) * time.Second / time.Duration(speed) / servoFrame)
+	if frames < 1 {
+		frames = 1
+	}
+	steps := make([]int, frames)
+	for i := range steps {
+		t := float64(i+1) / float64(frames)
+		steps[i] = from + int(float64(to-from)*ease(t)+0.5)
+	}
+	steps[frames-1] = to
+	return steps
+}
+
+// Move the servo on PWM0 from one position to another, then release it if
+// configured
+func servoMove(hw govattu.Vattu, from int, to int) {
+	hw.Pwm0Set(uint32(from))
+	for _, pos := range servoSteps(from, to) {
+		time.Sleep(servoFrame)
+		hw.Pwm0Set(uint32(pos))
+	}
+	if servoMotion().Release {
+		time.Sleep(servoSettle())
+		hw.Pwm0Set(0) // No pulses - the servo goes limp
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestCheckServoPins(t *testing.T) {
+	pin := func(n int) *int { return &n }
+	tests := []struct {
+		name string
+		rs   []*ReaderConfig
+		ok   bool
+	}{
+		{"one servo", []*ReaderConfig{{Name: "a", DoorPin: pin(18), DoorMode: "servo"}}, true},
+		{"pin 12", []*ReaderConfig{{Name: "a", DoorPin: pin(12), DoorMode: "servo"}}, true},
+		{"not PWM0", []*ReaderConfig{{Name: "a", DoorPin: pin(13), DoorMode: "servo"}}, false},
+		{"one door, two readers", []*ReaderConfig{
+			{Name: "in", DoorPin: pin(18), DoorMode: "servo"},
+			{Name: "out", DoorPin: pin(18), DoorMode: "servo"},
+		}, true},
+		{"two doors on PWM0", []*ReaderConfig{
+			{Name: "front", DoorPin: pin(12), DoorMode: "servo"},
+			{Name: "back", DoorPin: pin(18), DoorMode: "servo"},
+		}, false},
+		{"servo and relay", []*ReaderConfig{
+			{Name: "front", DoorPin: pin(18), DoorMode: "servo"},
+			{Name: "back", DoorPin: pin(23), DoorMode: "openhigh"},
+		}, true},
+	}
+	for _, tt := range tests {
+		if err := checkServoPins(tt.rs); (err == nil) != tt.ok {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package sound
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// ALSA output through aplay. Volume is applied to the samples here, so
+// the mixer can be left at full.
+type Aplay struct {
+	Device string // ALSA device, like "plughw:1,0". Empty for the default
+}
+
+func NewAplay(device string) *Aplay {
+	return &Aplay{Device: device}
+}
+
+func (a *Aplay) Play(s Sound, volume int) error {
+	var wav []byte
+	if s.File != "" {
+		raw, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return err
+		}
+		if wav, err = ScaleWav(raw, volume); err != nil {
+			return fmt.Errorf("%s: %v", s.File, err)
+		}
+	} else {
+		wav = ToneWav(s.Tones, volume)
+	}
+
+	args := []string{"-q"}
+	if a.Device != "" {
+		args = append(args, "-D", a.Device)
+	}
+	cmd := exec.Command("aplay", append(args, "-")...)
+	cmd.Stdin = bytes.NewReader(wav)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("aplay: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (a *Aplay) Close() error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package sound
+
+import (
+	"time"
+
+	"github.com/hjkoskel/govattu"
+)
+
+// Piezo buzzer on a GPIO pin. On 13 or 19 (hardware PWM1) it plays real
+// tones, with volume as the duty cycle. Any other pin just switches on
+// and off, for an active buzzer that makes its own tone.
+type Buzzer struct {
+	hw  govattu.Vattu
+	pin uint8
+	pwm bool
+}
+
+// EnablePWM1 turns PWM1 on or off, leaving PWM0 as it is. The servo uses
+// PWM0 and the enables share a register that can only be written whole,
+// so whoever owns PWM0 has to provide this.
+type EnablePWM1 func(hw govattu.Vattu, on bool)
+
+// PWM clock - the same divisor the servo uses, as the channels share it
+const pwmDivisor = 19
+const pwmClock = 19200000 / pwmDivisor
+
+func OpenBuzzer(pin uint8, enable EnablePWM1) (*Buzzer, error) {
+	hw, err := govattu.Open()
+	if err != nil {
+		return nil, err
+	}
+	b := &Buzzer{hw: hw, pin: pin}
+	switch pin {
+	case 13:
+		hw.PinMode(pin, govattu.ALT0) // ALT0 function for 13 is PWM1
+		b.pwm = true
+	case 19:
+		hw.PinMode(pin, govattu.ALT5) // ALT5 function for 19 is PWM1
+		b.pwm = true
+	default:
+		hw.PinMode(pin, govattu.ALToutput)
+		hw.PinClear(pin)
+	}
+	if b.pwm {
+		hw.Pwm1Set(0)
+		hw.PwmSetClock(pwmDivisor)
+		enable(hw, true)
+	}
+	return b, nil
+}
+
+func (b *Buzzer) on(freq int, volume int) {
+	if !b.pwm {
+		if volume > 0 {
+			b.hw.PinSet(b.pin)
+		}
+		return
+	}
+	rng := uint32(pwmClock / freq)
+	b.hw.Pwm1SetRange(rng)
+	b.hw.Pwm1Set(rng * uint32(volume) / 200) // 50% duty is loudest
+}
+
+func (b *Buzzer) off() {
+	if b.pwm {
+		b.hw.Pwm1Set(0)
+	} else {
+		b.hw.PinClear(b.pin)
+	}
+}
+
+func (b *Buzzer) Play(s Sound, volume int) error {
+	if s.File != "" {
+		return ErrNoFile
+	}
+	volume = clampVolume(volume)
+	for _, t := range s.Tones {
+		if t.Freq > 0 && volume > 0 {
+			b.on(t.Freq, volume)
+		} else {
+			b.off()
+		}
+		time.Sleep(t.Dur)
+	}
+	b.off()
+	return nil
+}
+
+func (b *Buzzer) Close() error {
+	b.off()
+	return b.hw.Close()
+}
@@ -0,0 +1,220 @@
+// Package sound plays short feedback sounds - tone sequences on a piezo
+// buzzer, or WAV files (and synthesized tones) through ALSA.
+package sound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// One note. Freq 0 is a rest.
+type Tone struct {
+	Freq int
+	Dur  time.Duration
+}
+
+// What to play - a tone sequence or a WAV file
+type Sound struct {
+	Tones []Tone
+	File  string
+}
+
+// Somewhere to play sounds. Play blocks until the sound is done.
+// Volume is 0-100.
+type Sink interface {
+	Play(s Sound, volume int) error
+	Close() error
+}
+
+var ErrNoFile = errors.New("sink can't play files")
+
+// Parse a tone sequence - "freq/ms" notes separated by spaces, like
+// "880/100 0/50 1320/200". Freq 0 is a rest.
+func ParseTones(s string) ([]Tone, error) {
+	var tones []Tone
+	for _, f := range strings.Fields(s) {
+		i := strings.Index(f, "/")
+		if i < 0 {
+			return nil, fmt.Errorf("bad tone %q, want freq/ms", f)
+		}
+		freq, err := strconv.Atoi(f[:i])
+		if err != nil || freq < 0 || freq > 20000 {
+			return nil, fmt.Errorf("bad tone frequency %q", f)
+		}
+		ms, err := strconv.Atoi(f[i+1:])
+		if err != nil || ms <= 0 || ms > 10000 {
+			return nil, fmt.Errorf("bad tone length %q", f)
+		}
+		tones = append(tones, Tone{Freq: freq, Dur: time.Duration(ms) * time.Millisecond})
+	}
+	if len(tones) == 0 {
+		return nil, errors.New("no tones")
+	}
+	return tones, nil
+}
+
+// Parse a sound setting - a .wav file path, or a tone sequence
+func Parse(s string) (Sound, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(strings.ToLower(s), ".wav") {
+		return Sound{File: s}, nil
+	}
+	tones, err := ParseTones(s)
+	return Sound{Tones: tones}, err
+}
+
+// Total length of a tone sequence
+func Length(tones []Tone) time.Duration {
+	var d time.Duration
+	for _, t := range tones {
+		d += t.Dur
+	}
+	return d
+}
+
+// SampleRate for synthesized tones
+const SampleRate = 22050
+
+func wavHeader(w *bytes.Buffer, channels int, rate int, bits int, size int) {
+	w.WriteString("RIFF")
+	binary.Write(w, binary.LittleEndian, uint32(36+size))
+	w.WriteString("WAVEfmt ")
+	binary.Write(w, binary.LittleEndian, uint32(16))
+	binary.Write(w, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(w, binary.LittleEndian, uint16(channels))
+	binary.Write(w, binary.LittleEndian, uint32(rate))
+	binary.Write(w, binary.LittleEndian, uint32(rate*channels*bits/8))
+	binary.Write(w, binary.LittleEndian, uint16(channels*bits/8))
+	binary.Write(w, binary.LittleEndian, uint16(bits))
+	w.WriteString("data")
+	binary.Write(w, binary.LittleEndian, uint32(size))
+}
+
+// Square wave WAV (16 bit mono) of a tone sequence, like the buzzer
+// would make
+func ToneWav(tones []Tone, volume int) []byte {
+	amp := int16(16000 * clampVolume(volume) / 100)
+	var pcm []int16
+	for _, t := range tones {
+		n := int(t.Dur * SampleRate / time.Second)
+		for i := 0; i < n; i++ {
+			v := int16(0)
+			if t.Freq > 0 {
+				v = amp
+				if (i*t.Freq*2/SampleRate)%2 == 1 {
+					v = -amp
+				}
+			}
+			pcm = append(pcm, v)
+		}
+	}
+	var b bytes.Buffer
+	wavHeader(&b, 1, SampleRate, 16, len(pcm)*2)
+	binary.Write(&b, binary.LittleEndian, pcm)
+	return b.Bytes()
+}
+
+// Scale a PCM WAV file (8 or 16 bit) to a volume. Returns a WAV with just
+// the fmt and data chunks.
+func ScaleWav(wav []byte, volume int) ([]byte, error) {
+	if len(wav) < 12 || string(wav[0:4]) != "RIFF" || string(wav[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+	var format, channels, bits uint16
+	var rate uint32
+	var data []byte
+	for p := 12; p+8 <= len(wav); {
+		id := string(wav[p : p+4])
+		size := int(binary.LittleEndian.Uint32(wav[p+4 : p+8]))
+		p += 8
+		if size < 0 || p+size > len(wav) {
+			size = len(wav) - p // Truncated, or streamed with no size
+		}
+		chunk := wav[p : p+size]
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("short fmt chunk")
+			}
+			format = binary.LittleEndian.Uint16(chunk[0:2])
+			channels = binary.LittleEndian.Uint16(chunk[2:4])
+			rate = binary.LittleEndian.Uint32(chunk[4:8])
+			bits = binary.LittleEndian.Uint16(chunk[14:16])
+		case "data":
+			data = chunk
+		}
+		p += size + size%2
+	}
+	if format != 1 || (bits != 8 && bits != 16) {
+		return nil, fmt.Errorf("unsupported WAV format %d, %d bits - want 8 or 16 bit PCM", format, bits)
+	}
+	if data == nil {
+		return nil, errors.New("no data chunk")
+	}
+
+	volume = clampVolume(volume)
+	out := make([]byte, len(data))
+	if bits == 8 {
+		for i, s := range data {
+			out[i] = byte(128 + (int(s)-128)*volume/100)
+		}
+	} else {
+		for i := 0; i+1 < len(data); i += 2 {
+			s := int(int16(binary.LittleEndian.Uint16(data[i:])))
+			binary.LittleEndian.PutUint16(out[i:], uint16(int16(s*volume/100)))
+		}
+	}
+	var b bytes.Buffer
+	wavHeader(&b, int(channels), int(rate), int(bits), len(out))
+	b.Write(out)
+	return b.Bytes(), nil
+}
+
+func clampVolume(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 100 {
+		return 100
+	}
+	return v
+}
+
+// Mock sink. Records what was played instead of playing it.
+type Mock struct {
+	mutex  sync.Mutex
+	Played []Played
+	Files  bool // Accept files (like ALSA) or not (like a buzzer)
+}
+
+type Played struct {
+	Sound  Sound
+	Volume int
+}
+
+func (m *Mock) Play(s Sound, volume int) error {
+	if s.File != "" && !m.Files {
+		return ErrNoFile
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Played = append(m.Played, Played{Sound: s, Volume: volume})
+	return nil
+}
+
+func (m *Mock) Close() error {
+	return nil
+}
+
+// What has been played so far
+func (m *Mock) Log() []Played {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]Played(nil), m.Played...)
+}
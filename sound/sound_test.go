@@ -0,0 +1,91 @@
+package sound
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse("880/100 0/50 1320/200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Tone{{880, 100 * time.Millisecond}, {0, 50 * time.Millisecond}, {1320, 200 * time.Millisecond}}
+	if len(s.Tones) != len(want) || s.File != "" {
+		t.Fatalf("got %+v", s)
+	}
+	for i := range want {
+		if s.Tones[i] != want[i] {
+			t.Errorf("tone %d got %+v, want %+v", i, s.Tones[i], want[i])
+		}
+	}
+	if Length(s.Tones) != 350*time.Millisecond {
+		t.Errorf("length %v", Length(s.Tones))
+	}
+
+	if s, err := Parse(" /usr/share/sounds/Door.WAV "); err != nil || s.File != "/usr/share/sounds/Door.WAV" {
+		t.Errorf("file got %+v, %v", s, err)
+	}
+	for _, bad := range []string{"", "880", "880/0", "x/100", "-5/100", "30000/100", "880/20000"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func sample(wav []byte, i int) int16 {
+	return int16(binary.LittleEndian.Uint16(wav[44+2*i:]))
+}
+
+func TestToneWav(t *testing.T) {
+	wav := ToneWav([]Tone{{1000, 10 * time.Millisecond}, {0, 10 * time.Millisecond}}, 50)
+	if string(wav[0:4]) != "RIFF" || string(wav[8:16]) != "WAVEfmt " || string(wav[36:40]) != "data" {
+		t.Fatalf("bad header % x", wav[:44])
+	}
+	n := int(binary.LittleEndian.Uint32(wav[40:44])) / 2
+	if n != 2*(SampleRate/100) || len(wav) != 44+2*n {
+		t.Fatalf("%d samples in %d bytes", n, len(wav))
+	}
+	// Square wave at half volume, then silence
+	if sample(wav, 0) != 8000 || sample(wav, 12) != -8000 {
+		t.Errorf("tone samples %d %d", sample(wav, 0), sample(wav, 12))
+	}
+	if sample(wav, n-1) != 0 {
+		t.Errorf("rest sample %d", sample(wav, n-1))
+	}
+}
+
+func TestScaleWav(t *testing.T) {
+	wav := ToneWav([]Tone{{440, 5 * time.Millisecond}}, 100)
+	scaled, err := ScaleWav(wav, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scaled) != len(wav) || sample(scaled, 0) != 4000 {
+		t.Errorf("scaled %d bytes, first sample %d", len(scaled), sample(scaled, 0))
+	}
+	if quiet, _ := ScaleWav(wav, 0); sample(quiet, 0) != 0 {
+		t.Errorf("volume 0 sample %d", sample(quiet, 0))
+	}
+	if _, err := ScaleWav([]byte("RIFF....WAVE"), 50); err == nil {
+		t.Error("WAV with no chunks accepted")
+	}
+	if _, err := ScaleWav([]byte("not a wav file"), 50); err == nil {
+		t.Error("non-WAV accepted")
+	}
+}
+
+func TestMock(t *testing.T) {
+	m := &Mock{}
+	if err := m.Play(Sound{File: "bell.wav"}, 50); err != ErrNoFile {
+		t.Errorf("buzzer-like mock played a file: %v", err)
+	}
+	m.Play(Sound{Tones: []Tone{{880, time.Millisecond}}}, 40)
+	m.Files = true
+	m.Play(Sound{File: "bell.wav"}, 60)
+	log := m.Log()
+	if len(log) != 2 || log[0].Volume != 40 || log[1].Sound.File != "bell.wav" {
+		t.Errorf("got %+v", log)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"goratt/dymo"
+)
+
+// Storage pass personality. An authorized member badges and gets a printed
+// temporary storage pass with their name, issue and expiry dates and a pass
+// ID (as text and a barcode).
+
+type StoragePassConfig struct {
+	Template string `yaml:"Template"` // Default StoragePassTemplate.svg
+	Days     int    `yaml:"Days"`     // Pass is good for this many days (Default 14)
+	Printer  string `yaml:"Printer"`  // "lp" (Default) or "raw"
+	Queue    string `yaml:"Queue"`    // CUPS printer for lp. Default is the default printer
+	Device   string `yaml:"Device"`   // LabelWriter device for raw, e.g. /dev/usb/lp0
+	Media    string `yaml:"Media"`    // Label stock for raw (Default 30252)
+	DotTab   int    `yaml:"DotTab"`   // Override the stock's dot tab, in bytes
+	Width    int    `yaml:"Width"`    // Label size in dots. Default is the template's size (lp) or the stock (raw)
+	Height   int    `yaml:"Height"`
+
+	Location     string `yaml:"Location"`     // Where passes from this node are for
+	MaxActive    int    `yaml:"MaxActive"`    // Open passes a member may hold. 0 is no limit
+	WarnHours    int    `yaml:"WarnHours"`    // Warn this long before expiry (Default 24)
+	KeepDays     int    `yaml:"KeepDays"`     // Forget closed passes after this many days (Default 30)
+	File         string `yaml:"File"`         // Pass registry (Default passes.json)
+	VerifyDevice string `yaml:"VerifyDevice"` // Keyboard-wedge barcode reader for checking passes
+}
+
+// Pass issued - off the wire
+type PassEvent struct {
+	Pass     string `json:"pass"`
+	Member   string `json:"member"`
+	Issued   string `json:"issued"`
+	Expires  string `json:"expires"`
+	Reader   string `json:"reader,omitempty"`
+	Location string `json:"location,omitempty"`
+	Printed  bool   `json:"printed"`
+	Error    string `json:"error,omitempty"`
+}
+
+func storageConfig() StoragePassConfig {
+	var sc StoragePassConfig
+	if cfg.StoragePass != nil {
+		sc = *cfg.StoragePass
+	}
+	if sc.Template == "" {
+		sc.Template = "StoragePassTemplate.svg"
+	}
+	if sc.Days <= 0 {
+		sc.Days = 14
+	}
+	if sc.Printer == "" {
+		sc.Printer = "lp"
+	}
+	if sc.Media == "" {
+		sc.Media = "30252"
+	}
+	return sc
+}
+
+// Label stock for raw printing
+func passMedia(sc StoragePassConfig) (dymo.Media, bool) {
+	m, ok := dymo.Labels[sc.Media]
+	if sc.DotTab != 0 {
+		m.DotTab = sc.DotTab
+	}
+	return m, ok
+}
+
+// Check the storage pass config at startup
+func loadStoragePass() {
+	if cfg.Personality != "storage" {
+		return
+	}
+	sc := storageConfig()
+	if sc.Printer != "lp" && sc.Printer != "raw" {
+		log.Fatalf("StoragePass Printer must be \"lp\" or \"raw\"")
+	}
+	if sc.Printer == "raw" && sc.Device == "" {
+		log.Fatal("StoragePass Printer raw needs a Device")
+	}
+	if _, ok := passMedia(sc); sc.Printer == "raw" && !ok {
+		log.Fatalf("Unknown StoragePass Media \"%s\"", sc.Media)
+	}
+	if _, err := ioutil.ReadFile(sc.Template); err != nil {
+		log.Fatal("StoragePass Template: ", err)
+	}
+}
+
+// Pass IDs are random, so a barcode can't be made up from a date. No I, L,
+// O or U, so they read back easily.
+const passIDChars = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+const passIDLength = 10 // 50 bits
+
+// A new pass ID, not already in the registry
+func newPassID() (string, error) {
+	buf := make([]byte, passIDLength)
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		id := make([]byte, passIDLength)
+		for i, b := range buf {
+			id[i] = passIDChars[b%32]
+		}
+		passMutex.Lock()
+		_, taken := passes[string(id)]
+		passMutex.Unlock()
+		if !taken {
+			return string(id), nil
+		}
+	}
+}
+
+// Render and print a pass
+func printPass(sc StoragePassConfig, fields map[string]string, id string) error {
+	template, err := ioutil.ReadFile(sc.Template)
+	if err != nil {
+		return err
+	}
+	svg, err := fillLabel(template, fields, id)
+	if err != nil {
+		return err
+	}
+	if sc.Printer == "raw" {
+		media, _ := passMedia(sc)
+		width, height := sc.Width, sc.Height
+		if width == 0 && height == 0 {
+			// Landscape, the size of the label
+			width, height = media.Length, media.Width
+		}
+		pngData, err := rasterizeLabel(svg, width, height)
+		if err != nil {
+			return err
+		}
+		return printRaw(sc.Device, media, pngData)
+	}
+	pngData, err := rasterizeLabel(svg, sc.Width, sc.Height)
+	if err != nil {
+		return err
+	}
+	return printLP(sc.Queue, pngData)
+}
+
+// Member granted - print them a pass
+func IssuePass(r *ReaderConfig, tag ACLlist) {
+	sc := storageConfig()
+	now := time.Now()
+	expires := now.AddDate(0, 0, sc.Days)
+	id, err := newPassID()
+	ev := PassEvent{
+		Pass:     id,
+		Member:   tag.Member,
+		Issued:   now.Format("2006-01-02"),
+		Expires:  expires.Format("2006-01-02"),
+		Reader:   r.Name,
+		Location: sc.Location,
+	}
+	fields := map[string]string{
+		"member":  tag.Member,
+		"issued":  now.Format("Jan 2, 2006"),
+		"expires": expires.Format("Jan 2, 2006"),
+		"pass":    ev.Pass,
+	}
+
+	if err != nil {
+		fmt.Println("Error making pass ID:", err)
+		ev.Error = err.Error()
+		accessDenied("denied")
+	} else if passLimitReached(tag.Member) {
+		fmt.Printf("%s already has %d open storage passes\n", tag.Member, sc.MaxActive)
+		ev.Error = "limit"
+		accessDenied("denied")
+	} else {
+		fmt.Printf("Printing storage pass %s for %s\n", ev.Pass, tag.Member)
+		ledShow("granted", 0)
+		err = printPass(sc, fields, ev.Pass)
+		if err != nil {
+			fmt.Println("Error printing storage pass:", err)
+			ev.Error = err.Error()
+			if err == dymo.ErrPaperOut {
+				publishAlarm(AlarmEvent{Alarm: "labels", Active: true, Detail: err.Error()})
+			}
+			accessDenied("denied")
+		} else {
+			ev.Printed = true
+			err = recordPass(&PassRecord{ID: ev.Pass, Member: tag.Member, Issued: now, Expires: expires, Location: sc.Location})
+			if err != nil {
+				fmt.Println("Error recording storage pass:", err)
+				ev.Error = err.Error()
+			}
+			ledEnd("granted")
+		}
+	}
+
+	message, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Println("Error encoding pass event:", err)
+		return
+	}
+	var topic string = fmt.Sprintf("ratt/status/node/%s/personality/pass", cfg.ClientID)
+	client.Publish(topic, 0, false, message)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hjkoskel/govattu"
+)
+
+// Tool personality. A grant turns the enable output (DoorPin, per Mode) on
+// and keeps it on until the member badges out, another authorized member
+// takes over, the idle timeout expires or the logout button is pressed.
+
+type ToolConfig struct {
+	IdleSecs  int    `yaml:"IdleSecs"`  // Session ends after this long idle
+	WarnSecs  int    `yaml:"WarnSecs"`  // Warn this long before the idle timeout
+	LogoutPin *uint8 `yaml:"LogoutPin"` // Button to ground
+
+	CurrentSense *CurrentSenseConfig `yaml:"CurrentSense"`
+}
+
+// Session start/end - off the wire
+type SessionEvent struct {
+	Member   string `json:"member"`
+	Reader   string `json:"reader,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Duration int64  `json:"duration,omitempty"` // Seconds
+	RunTime  int64  `json:"runtime,omitempty"`  // Seconds the tool was running
+}
+
+type toolSession struct {
+	reader       *ReaderConfig
+	tag          ACLlist
+	start        time.Time
+	lastActivity time.Time
+	warned       bool
+	runTime      time.Duration
+	done         chan struct{}
+}
+
+var toolMutex sync.Mutex
+var session *toolSession
+
+func toolConfig() ToolConfig {
+	if cfg.Tool != nil {
+		return *cfg.Tool
+	}
+	return ToolConfig{}
+}
+
+func toolIdle() time.Duration {
+	if t := toolConfig(); t.IdleSecs > 0 {
+		return time.Duration(t.IdleSecs) * time.Second
+	}
+	return 30 * time.Minute
+}
+
+func toolWarn() time.Duration {
+	if t := toolConfig(); t.WarnSecs > 0 {
+		return time.Duration(t.WarnSecs) * time.Second
+	}
+	return time.Minute
+}
+
+// Check the personality at startup
+func loadPersonality() {
+	switch cfg.Personality {
+	case "", "door", "tool", "storage":
+	default:
+		log.Fatalf("Unknown Personality \"%s\"", cfg.Personality)
+	}
+}
+
+func publishSession(event string, ev SessionEvent) {
+	message, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Println("Error encoding session event:", err)
+		return
+	}
+	var topic string = fmt.Sprintf("ratt/status/node/%s/personality/%s", cfg.ClientID, event)
+	client.Publish(topic, 0, false, message)
+}
+
+// Turn a reader's enable output on or off. Nothing is turned on while the
+// e-stop is latched - it is checked under the door lock, which tripEstop
+// takes to turn the outputs off after latching, so a grant racing the
+// e-stop can't leave an output on.
+func setToolEnable(r *ReaderConfig, on bool) {
+	l := doorLock(r.DoorPin)
+	l.Lock()
+	defer l.Unlock()
+	if on && estopActive() {
+		fmt.Printf("Emergency stop latched - %s output stays off\n", r.Name)
+		return
+	}
+	set_door(r.DoorPin, cfg.ServoOpen, cfg.ServoClose, r.DoorMode, on)
+}
+
+// Member granted on the tool - start their session, taking over any other
+func ToolGrant(r *ReaderConfig, tag ACLlist) {
+	now := time.Now()
+	s := &toolSession{reader: r, tag: tag, start: now, lastActivity: now, done: make(chan struct{})}
+
+	toolMutex.Lock()
+	old := session
+	if old != nil && old.tag.Member == tag.Member {
+		toolMutex.Unlock()
+		endSession(old, "badgeout")
+		return
+	}
+	session = s
+	if old != nil {
+		close(old.done)
+	}
+	toolMutex.Unlock()
+
+	if old != nil {
+		fmt.Printf("Tool taken over from %s by %s\n", old.tag.Member, tag.Member)
+		publishSession("logout", SessionEvent{Member: old.tag.Member, Reader: old.reader.Name, Reason: "takeover", Duration: int64(now.Sub(old.start).Seconds()), RunTime: old.runSeconds()})
+		if old.reader != r {
+			// Taken over on another reader - move the enable across
+			setToolEnable(old.reader, false)
+			setToolEnable(r, true)
+		}
+	} else {
+		setToolEnable(r, true)
+	}
+	if estopActive() {
+		// Tripped since admitMember checked - tripEstop may have missed s
+		toolMutex.Lock()
+		if session == s {
+			session = nil
+			close(s.done)
+		}
+		toolMutex.Unlock()
+		fmt.Printf("Emergency stop latched - no session for %s\n", tag.Member)
+		ledRefresh()
+		return
+	}
+
+	fmt.Printf("Tool session started for %s\n", tag.Member)
+	publishSession("login", SessionEvent{Member: tag.Member, Reader: r.Name})
+	ledRefresh()
+	go watchSession(s)
+}
+
+// Remote open - start a session for the member on the first reader, as if
+// they had badged. If it is already theirs, it just counts as activity.
+func ToolRemoteOpen(member string) {
+	toolMutex.Lock()
+	current := session != nil && session.tag.Member == member
+	toolMutex.Unlock()
+	if current {
+		toolActivity()
+		return
+	}
+	tag := ACLlist{Member: member, Allowed: true}
+	for _, t := range validTags {
+		if t.Member == member {
+			tag = t
+			break
+		}
+	}
+	ToolGrant(configuredReaders()[0], tag)
+}
+
+// End a session, if it is still the current one
+func endSession(s *toolSession, reason string) {
+	toolMutex.Lock()
+	if session != s {
+		toolMutex.Unlock()
+		return
+	}
+	session = nil
+	close(s.done)
+	toolMutex.Unlock()
+
+	setToolEnable(s.reader, false)
+	duration := time.Since(s.start)
+	fmt.Printf("Tool session ended for %s (%s) after %s\n", s.tag.Member, reason, duration.Round(time.Second))
+	publishSession("logout", SessionEvent{Member: s.tag.Member, Reader: s.reader.Name, Reason: reason, Duration: int64(duration.Seconds()), RunTime: s.runSeconds()})
+	ledEnd("timeout-warning")
+	ledRefresh()
+}
+
+// Current member swiped again - badge out. Returns true if it was a badge out.
+func toolBadgeOut(id uint64) bool {
+	toolMutex.Lock()
+	s := session
+	toolMutex.Unlock()
+	if s == nil || s.tag.Tag != id {
+		return false
+	}
+	endSession(s, "badgeout")
+	return true
+}
+
+// Logout button (or Escape on a keyboard reader)
+func Signout() {
+	toolMutex.Lock()
+	s := session
+	toolMutex.Unlock()
+	if s != nil {
+		endSession(s, "button")
+	}
+}
+
+// Who is on the tool, and how long until they idle out
+func toolRemaining() (string, time.Duration) {
+	toolMutex.Lock()
+	defer toolMutex.Unlock()
+	if session == nil {
+		return "", 0
+	}
+	left := toolIdle() - time.Since(session.lastActivity)
+	if left < 0 {
+		left = 0
+	}
+	return session.tag.Member, left
+}
+
+func toolSessionActive() bool {
+	toolMutex.Lock()
+	defer toolMutex.Unlock()
+	return session != nil
+}
+
+// The tool is being used - push the idle timeout back
+func toolActivity() {
+	toolMutex.Lock()
+	warned := false
+	if session != nil {
+		session.lastActivity = time.Now()
+		warned = session.warned
+		session.warned = false
+	}
+	toolMutex.Unlock()
+	if warned {
+		ledEnd("timeout-warning")
+	}
+}
+
+// The tool ran for d - add it to the session's run time
+func toolRunning(d time.Duration) {
+	toolMutex.Lock()
+	defer toolMutex.Unlock()
+	if session != nil {
+		session.runTime += d
+	}
+}
+
+func (s *toolSession) runSeconds() int64 {
+	toolMutex.Lock()
+	defer toolMutex.Unlock()
+	return int64(s.runTime.Seconds())
+}
+
+// Idle timeout, warning and logout button for one session
+func watchSession(s *toolSession) {
+	tc := toolConfig()
+	var hw govattu.Vattu
+	if tc.LogoutPin != nil {
+		var err error
+		hw, err = govattu.Open()
+		if err != nil {
+			// govattu hands back an unusable Vattu with the error
+			fmt.Println("Logout button error:", err)
+			hw = nil
+		} else {
+			defer hw.Close()
+			hw.PinMode(*tc.LogoutPin, govattu.ALTinput)
+			hw.PullMode(*tc.LogoutPin, govattu.PULLup)
+		}
+	}
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		if hw != nil && !hw.ReadPinLevel(*tc.LogoutPin) {
+			endSession(s, "button")
+			return
+		}
+
+		toolMutex.Lock()
+		idle := time.Since(s.lastActivity)
+		warn := !s.warned && idle >= toolIdle()-toolWarn()
+		if warn {
+			s.warned = true
+		}
+		toolMutex.Unlock()
+
+		if idle >= toolIdle() {
+			endSession(s, "timeout")
+			return
+		}
+		if warn {
+			fmt.Printf("Tool session for %s about to time out\n", s.tag.Member)
+			ledShow("timeout-warning", 0)
+			soundPlay("timeout-warning")
+		}
+	}
+}
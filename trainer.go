@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Trainer override. After a member at or above TrainerLevel is granted, a
+// member who isn't yet authorized can badge within TrainerSecs and is let in
+// for one session. Both are recorded in the access event.
+
+var trainerMutex sync.Mutex
+var lastTrainer *ACLlist
+var lastTrainerTime time.Time
+
+func isTrainer(tag ACLlist) bool {
+	return cfg.TrainerLevel != nil && tag.Allowed && tag.Level >= *cfg.TrainerLevel
+}
+
+func trainerWindow() time.Duration {
+	if cfg.TrainerSecs > 0 {
+		return time.Duration(cfg.TrainerSecs) * time.Second
+	}
+	return 60 * time.Second
+}
+
+// A trainer was just granted - open the window for a trainee
+func trainerGranted(tag ACLlist) {
+	if !isTrainer(tag) {
+		return
+	}
+	trainerMutex.Lock()
+	defer trainerMutex.Unlock()
+	lastTrainer = &tag
+	lastTrainerTime = time.Now()
+}
+
+// The trainer whose window this unauthorized member badged in, if any.
+// Each trainer swipe is good for one trainee session.
+func takeTrainer(tag ACLlist) (ACLlist, bool) {
+	trainerMutex.Lock()
+	defer trainerMutex.Unlock()
+	if lastTrainer == nil || time.Since(lastTrainerTime) > trainerWindow() || lastTrainer.Member == tag.Member {
+		return ACLlist{}, false
+	}
+	trainer := *lastTrainer
+	lastTrainer = nil
+	return trainer, true
+}
+
+// Unauthorized member - if a trainer just badged, they go on through the
+// same checks (passback, PIN, two-person) as an authorized member
+func traineeOf(tag ACLlist) ACLlist {
+	if tag.Allowed || tag.Override != "" {
+		return tag
+	}
+	trainer, ok := takeTrainer(tag)
+	if !ok {
+		return tag
+	}
+	fmt.Printf("Training session: %s trained by %s\n", tag.Member, trainer.Member)
+	tag.trainer = trainer.Member
+	return tag
+}
+
+// Authorized, or let in by a trainer
+func (tag ACLlist) admitted() bool {
+	return tag.Allowed || tag.trainer != ""
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTraineeSchedule(t *testing.T) {
+	level := 5
+	cfg.TrainerLevel = &level
+	// Level 1 has a schedule that is never open, level 2 has none
+	cfg.AccessSchedules = &ScheduleConfig{
+		Schedules: map[string]Schedule{"never": {}},
+		Levels:    map[int]string{1: "never"},
+	}
+	defer func() {
+		cfg.TrainerLevel = nil
+		cfg.AccessSchedules = nil
+		lastTrainer = nil
+	}()
+	trainer := ACLlist{Tag: 1, Member: "alice", Level: 5, Allowed: true}
+	now := time.Now()
+
+	trainerGranted(trainer)
+	tag := traineeOf(ACLlist{Tag: 2, Member: "bob", Level: 1})
+	if tag.trainer != "alice" || !tag.admitted() {
+		t.Fatalf("not a trainee: %+v", tag)
+	}
+	if !scheduleDenies(tag, now) {
+		t.Error("trainee let in outside their level's schedule")
+	}
+
+	trainerGranted(trainer)
+	if tag := traineeOf(ACLlist{Tag: 3, Member: "carol", Level: 2}); scheduleDenies(tag, now) {
+		t.Error("unscheduled trainee denied")
+	}
+
+	// The trainer's swipe was used up
+	if tag := traineeOf(ACLlist{Tag: 4, Member: "dave", Level: 2}); tag.admitted() {
+		t.Error("second trainee on one trainer swipe")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Two-person rule. With TwoPersonSecs set, a grant needs two different
+// authorized members to badge within that many seconds. The first swipe
+// waits (with its own LED pattern) for the second.
+
+type twoPersonWait struct {
+	reader *ReaderConfig
+	tag    ACLlist
+	timer  *time.Timer
+}
+
+var twoPersonMutex sync.Mutex
+var twoPersonPending *twoPersonWait
+
+// Returns the first member once a second, different member has badged.
+// ok is false while waiting for the second person.
+func twoPersonCheck(r *ReaderConfig, tag ACLlist) (first ACLlist, ok bool) {
+	twoPersonMutex.Lock()
+	defer twoPersonMutex.Unlock()
+
+	w := twoPersonPending
+	if w != nil && w.tag.Member != tag.Member {
+		w.timer.Stop()
+		twoPersonPending = nil
+		fmt.Printf("Second person %s with %s\n", tag.Member, w.tag.Member)
+		ledEnd("second-person")
+		return w.tag, true
+	}
+	if w != nil {
+		// Same member again - just restart their wait
+		w.timer.Stop()
+	}
+
+	w = &twoPersonWait{reader: r, tag: tag}
+	w.timer = time.AfterFunc(time.Duration(cfg.TwoPersonSecs)*time.Second, func() { twoPersonExpire(w) })
+	twoPersonPending = w
+	fmt.Printf("Member %s waiting for second person\n", tag.Member)
+	ledShow("second-person", time.Duration(cfg.TwoPersonSecs)*time.Second)
+	return ACLlist{}, false
+}
+
+func twoPersonExpire(w *twoPersonWait) {
+	twoPersonMutex.Lock()
+	if twoPersonPending != w {
+		twoPersonMutex.Unlock()
+		return
+	}
+	twoPersonPending = nil
+	twoPersonMutex.Unlock()
+
+	fmt.Printf("No second person for %s\n", w.tag.Member)
+	publishAccess(w.reader, 0, w.tag.Member, "twoperson")
+	ledEnd("second-person")
+}
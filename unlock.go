@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Scheduled unlock periods. During an unlock window the doors are held open,
+// optionally only once a member at FirstInLevel or above has badged in.
+// Remote overrides and first-person-in state are kept in StateFile so they
+// survive a restart.
+
+type UnlockSchedule struct {
+	Name         string `yaml:"Name"`
+	TimeWindow   `yaml:",inline"`
+	Holidays     bool `yaml:"Holidays"`     // Unlock on holidays too
+	FirstInLevel *int `yaml:"FirstInLevel"` // Stay locked until someone at this level badges in
+}
+
+// Persistent unlock state
+type UnlockState struct {
+	Override string            `json:"override"` // "unlock", "lock" or "" for the schedule
+	FirstIn  map[string]string `json:"first_in"` // Schedule name -> date of the window first-in happened in
+}
+
+// Remote unlock command - signed like an open request, with the mode
+// appended to the tool name ("frontdoor/unlock")
+type UnlockRequest struct {
+	OpenRequest
+	Mode string `json:"mode"` // "unlock", "lock" or "auto"
+}
+
+var unlockMutex sync.Mutex
+var unlockUpdateMutex sync.Mutex
+var unlockState = UnlockState{FirstIn: make(map[string]string)}
+var unlocked bool
+var holdOpen bool
+var doorOpen = make(map[int]bool) // Door pin -> held open. Guarded by unlockUpdateMutex
+
+func stateFileName() string {
+	if cfg.StateFile != "" {
+		return cfg.StateFile
+	}
+	return "goratt.state"
+}
+
+// Prepare the unlock schedules and read back saved state at startup
+func loadUnlockState() {
+	names := make(map[string]bool)
+	for i := range cfg.UnlockSchedules {
+		s := &cfg.UnlockSchedules[i]
+		if s.Name == "" || names[s.Name] {
+			log.Fatalf("Unlock schedule %d needs a unique Name", i)
+		}
+		names[s.Name] = true
+		if err := s.init(); err != nil {
+			log.Fatalf("Unlock schedule %s: %v", s.Name, err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(stateFileName())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println("Error reading state file: ", err)
+		}
+		return
+	}
+	unlockMutex.Lock()
+	defer unlockMutex.Unlock()
+	if err := json.Unmarshal(data, &unlockState); err != nil {
+		fmt.Println("Error decoding state file: ", err)
+	}
+	if unlockState.FirstIn == nil {
+		unlockState.FirstIn = make(map[string]string)
+	}
+	if unlockState.Override != "" {
+		fmt.Printf("Unlock override \"%s\" from state file\n", unlockState.Override)
+	}
+}
+
+// Caller holds unlockMutex
+func saveUnlockState() {
+	data, err := json.Marshal(unlockState)
+	if err != nil {
+		fmt.Println("Error encoding state: ", err)
+		return
+	}
+	err = ioutil.WriteFile(stateFileName()+".tmp", data, 0644)
+	if err == nil {
+		err = os.Rename(stateFileName()+".tmp", stateFileName())
+	}
+	if err != nil {
+		fmt.Println("Error writing state file: ", err)
+	}
+}
+
+// -holdopen flag - unlocked until restarted without it
+func holdOpenOverride() {
+	unlockMutex.Lock()
+	holdOpen = true
+	unlockMutex.Unlock()
+	updateUnlock()
+}
+
+func (s *UnlockSchedule) active(t time.Time) bool {
+	return s.activeAt(t.In(scheduleLocation), !s.Holidays)
+}
+
+// Should the doors be unlocked, and why. Caller holds unlockMutex.
+func unlockWanted(now time.Time) (bool, string) {
+	if holdOpen {
+		return true, "holdopen"
+	}
+	switch unlockState.Override {
+	case "unlock":
+		return true, "override"
+	case "lock":
+		return false, "override"
+	}
+	for i := range cfg.UnlockSchedules {
+		s := &cfg.UnlockSchedules[i]
+		if !s.active(now) {
+			continue
+		}
+		if s.FirstInLevel != nil && unlockState.FirstIn[s.Name] != s.startDate(now.In(scheduleLocation)) {
+			continue
+		}
+		return true, s.Name
+	}
+	return false, ""
+}
+
+func doorsUnlocked() bool {
+	unlockMutex.Lock()
+	defer unlockMutex.Unlock()
+	return unlocked
+}
+
+// Is the door on this pin being held open - by the schedule, an override or
+// the fire alarm?
+func doorHeld(pin *int) bool {
+	return doorsUnlocked() || fireHoldsPin(pin)
+}
+
+// Bring the doors in line with the schedule, overrides and fire alarm
+func updateUnlock() {
+	unlockUpdateMutex.Lock()
+	defer unlockUpdateMutex.Unlock()
+
+	unlockMutex.Lock()
+	want, why := unlockWanted(time.Now())
+	changed := want != unlocked
+	unlocked = want
+	unlockMutex.Unlock()
+
+	if changed && want {
+		fmt.Printf("Unlocking doors (%s)\n", why)
+	} else if changed {
+		fmt.Println("Locking doors")
+	}
+	done := make(map[int]bool)
+	for _, r := range configuredReaders() {
+		if r.DoorPin == nil || done[*r.DoorPin] {
+			continue
+		}
+		done[*r.DoorPin] = true
+		open := want || fireHoldsPin(r.DoorPin)
+		if doorOpen[*r.DoorPin] == open {
+			continue
+		}
+		doorOpen[*r.DoorPin] = open
+		l := doorLock(r.DoorPin)
+		l.Lock()
+		set_door(r.DoorPin, cfg.ServoOpen, cfg.ServoClose, r.DoorMode, open)
+		l.Unlock()
+	}
+	if !changed {
+		return
+	}
+
+	ledRefresh()
+
+	if client != nil {
+		var topic string = fmt.Sprintf("ratt/status/node/%s/unlock", cfg.ClientID)
+		var message string = fmt.Sprintf("{\"unlocked\":%t,\"reason\":\"%s\"}", want, why)
+		client.Publish(topic, 0, false, message)
+	}
+}
+
+func UnlockScheduler() {
+	for {
+		updateUnlock()
+		time.Sleep(15 * time.Second)
+	}
+}
+
+// A member was granted - satisfy any first-person-in rule they qualify for
+func FirstPersonIn(tag ACLlist) {
+	now := time.Now()
+	found := false
+	unlockMutex.Lock()
+	for i := range cfg.UnlockSchedules {
+		s := &cfg.UnlockSchedules[i]
+		if s.FirstInLevel == nil || tag.Level < *s.FirstInLevel || !s.active(now) {
+			continue
+		}
+		date := s.startDate(now.In(scheduleLocation))
+		if unlockState.FirstIn[s.Name] != date {
+			fmt.Printf("First person in for %s: %s\n", s.Name, tag.Member)
+			unlockState.FirstIn[s.Name] = date
+			found = true
+		}
+	}
+	if found {
+		saveUnlockState()
+	}
+	unlockMutex.Unlock()
+
+	if found {
+		updateUnlock()
+	}
+}
+
+// Remote lock/unlock/auto override
+func UnlockCommand(payload []byte) {
+	if cfg.OpenSecret == "" || cfg.OpenToolName == "" {
+		fmt.Println("No OpenSecret or OpenToolName configured - remote unlock disabled")
+		return
+	}
+	var request UnlockRequest
+	err := json.Unmarshal(payload, &request)
+	if err != nil {
+		fmt.Println("Error decoding JSON:", err)
+		return
+	}
+	err = VerifyRemoteRequest(request.OpenRequest, cfg.OpenToolName+"/"+request.Mode)
+	if err != nil {
+		fmt.Printf("Unlock request verification failed: %s\n", err)
+		return
+	}
+
+	unlockMutex.Lock()
+	switch request.Mode {
+	case "unlock", "lock":
+		unlockState.Override = request.Mode
+	case "auto":
+		unlockState.Override = ""
+	default:
+		unlockMutex.Unlock()
+		fmt.Printf("Unknown unlock mode \"%s\"\n", request.Mode)
+		return
+	}
+	saveUnlockState()
+	unlockMutex.Unlock()
+
+	fmt.Printf("Unlock override \"%s\" by %s\n", request.Mode, request.Member)
+	updateUnlock()
+}
@@ -15,6 +15,19 @@ const (
 	ETX = 0x03
 )
 
+// Keypad values for the non-digit keys of a Wiegand keypad
+const (
+	KeyStar  = 0x0A
+	KeyPound = 0x0B
+)
+
+// Frame is one decoded frame from the reader - either a card or a keypress.
+type Frame struct {
+	Card  uint64
+	Key   byte
+	IsKey bool
+}
+
 // RFIDReader encapsulates the serial port.
 type RFIDReader struct {
 	port serial.Port
@@ -61,27 +74,40 @@ func (r *RFIDReader) Close() error {
 
 // GetCard reads a single card frame starting with STX and ending with ETX.
 // On no data available, returns ("", nil). On parse issues, returns an error.
+// Keypress frames are discarded.
 func (r *RFIDReader) GetCard() (uint64, error) {
+	f, err := r.GetFrame()
+	if err != nil || f.IsKey {
+		return 0, err
+	}
+	return f.Card, nil
+}
+
+// GetFrame reads a single frame starting with STX and ending with ETX.
+// Keypads send 4-bit (one hex digit) or 8-bit (key in the low nibble,
+// its complement in the high nibble) bursts, which come back as a keypress.
+// On no data available, returns an empty Frame.
+func (r *RFIDReader) GetFrame() (Frame, error) {
 	if r.port == nil {
-		return 0, errors.New("port not initialized")
+		return Frame{}, errors.New("port not initialized")
 	}
 
 	// Attempt to read one byte; if timeout (0 bytes), treat as no data.
 	first := make([]byte, 1)
 	n, err := r.port.Read(first)
 	if err != nil {
-		return 0, fmt.Errorf("read STX: %w", err)
+		return Frame{}, fmt.Errorf("read STX: %w", err)
 	}
 	if n == 0 {
 		// No data available (timeout); mirror Python's None -> empty string here.
-		return 0, nil
+		return Frame{}, nil
 	}
 
 	// Look for STX
 	if first[0] != STX {
 		// Noise or partial frame; flush and return none.
 		r.flush()
-		return 0, nil
+		return Frame{}, nil
 	}
 
 	// Read until ETX, building ASCII ID characters.
@@ -91,12 +117,12 @@ func (r *RFIDReader) GetCard() (uint64, error) {
 	for {
 		n, err := r.port.Read(buf)
 		if err != nil {
-			return 0, fmt.Errorf("read body: %w", err)
+			return Frame{}, fmt.Errorf("read body: %w", err)
 		}
 		if n == 0 {
 			// Timeout mid-frame; treat as incomplete frame -> flush and return none.
 			r.flush()
-			return 0, nil
+			return Frame{}, nil
 		}
 		b := buf[0]
 		if b == ETX {
@@ -108,6 +134,11 @@ func (r *RFIDReader) GetCard() (uint64, error) {
 
 	ID := idBuilder.String()
 
+	// Short frames are keypresses
+	if len(ID) == 1 || len(ID) == 2 {
+		return keyFrame(ID)
+	}
+
 	// Left-pad ID to length 10, same as Python loop `while len(ID) < 10`
 	for len(ID) < 10 {
 		ID = "0" + ID
@@ -120,11 +151,11 @@ func (r *RFIDReader) GetCard() (uint64, error) {
 	for i := 0; i <= 8; i += 2 {
 		hi, err := hexCharToNibble(ID[i])
 		if err != nil {
-			return 0, fmt.Errorf("invalid hex at pos %d: %w", i, err)
+			return Frame{}, fmt.Errorf("invalid hex at pos %d: %w", i, err)
 		}
 		lo, err := hexCharToNibble(ID[i+1])
 		if err != nil {
-			return 0, fmt.Errorf("invalid hex at pos %d: %w", i+1, err)
+			return Frame{}, fmt.Errorf("invalid hex at pos %d: %w", i+1, err)
 		}
 		val := byte((hi << 4) | lo)
 		checksum ^= val
@@ -134,27 +165,27 @@ func (r *RFIDReader) GetCard() (uint64, error) {
 	// Tag formed from digits 1,2,3: ((ID[1]<<8) + (ID[2]<<4) + (ID[3]<<0))
 	d1, err := hexCharToNibble(ID[1])
 	if err != nil {
-		return 0, fmt.Errorf("invalid tag nibble 1: %w", err)
+		return Frame{}, fmt.Errorf("invalid tag nibble 1: %w", err)
 	}
 	d2, err := hexCharToNibble(ID[2])
 	if err != nil {
-		return 0, fmt.Errorf("invalid tag nibble 2: %w", err)
+		return Frame{}, fmt.Errorf("invalid tag nibble 2: %w", err)
 	}
 	d3, err := hexCharToNibble(ID[3])
 	if err != nil {
-		return 0, fmt.Errorf("invalid tag nibble 3: %w", err)
+		return Frame{}, fmt.Errorf("invalid tag nibble 3: %w", err)
 	}
 	tagVal := (d1 << 8) + (d2 << 4) + d3
 	tagHex := fmt.Sprintf("0x%X", tagVal)
 
 	// Card is the decimal of hex substring ID[4:10]
 	if len(ID) < 10 {
-		return 0, fmt.Errorf("ID length < 10 after padding? got %d", len(ID))
+		return Frame{}, fmt.Errorf("ID length < 10 after padding? got %d", len(ID))
 	}
 	cardHex := ID[4:10]
 	cardInt, err := strconv.ParseUint(cardHex, 16, 32)
 	if err != nil {
-		return 0, fmt.Errorf("parse card hex %q: %w", cardHex, err)
+		return Frame{}, fmt.Errorf("parse card hex %q: %w", cardHex, err)
 	}
 
 	fmt.Println("------------------------------------------")
@@ -164,7 +195,28 @@ func (r *RFIDReader) GetCard() (uint64, error) {
 	fmt.Println("Checksum: ", checksumHex)
 	fmt.Println("------------------------------------------")
 
-	return cardInt, nil
+	return Frame{Card: cardInt}, nil
+}
+
+// keyFrame decodes a 4-bit or 8-bit keypad burst
+func keyFrame(ID string) (Frame, error) {
+	lo, err := hexCharToNibble(ID[len(ID)-1])
+	if err != nil {
+		return Frame{}, fmt.Errorf("invalid key %q: %w", ID, err)
+	}
+	if len(ID) == 2 {
+		hi, err := hexCharToNibble(ID[0])
+		if err != nil {
+			return Frame{}, fmt.Errorf("invalid key %q: %w", ID, err)
+		}
+		if hi != (^lo & 0x0f) {
+			return Frame{}, fmt.Errorf("bad key check %q", ID)
+		}
+	}
+	if lo > KeyPound {
+		return Frame{}, fmt.Errorf("unknown key %q", ID)
+	}
+	return Frame{Key: byte(lo), IsKey: true}, nil
 }
 
 // flush drains the input buffer to discard any partial frames.
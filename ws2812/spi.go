@@ -0,0 +1,122 @@
+package ws2812
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const spiIocWrMaxHz = 0x40046b04
+
+const bufsizParam = "/sys/module/spidev/parameters/bufsiz"
+
+// SpidevBufsiz is the most spidev will take in one write. A frame can't be
+// split over several writes - the gap between them would latch the LEDs
+// part way along - so it has to fit. Raise it with spidev.bufsiz=N on the
+// kernel command line.
+func SpidevBufsiz() int {
+	data, err := ioutil.ReadFile(bufsizParam)
+	if err != nil {
+		return 4096
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || n <= 0 {
+		return 4096
+	}
+	return n
+}
+
+// OpenSPI opens a spidev device (e.g. /dev/spidev0.0) at the LED bit rate
+func OpenSPI(device string) (*os.File, error) {
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	hz := uint32(SPIHz)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), spiIocWrMaxHz, uintptr(unsafe.Pointer(&hz)))
+	if errno != 0 {
+		f.Close()
+		return nil, fmt.Errorf("spi speed: %w", errno)
+	}
+	return f, nil
+}
+
+// Strip animates a pattern on a strip of LEDs. Frames go to w, which is a
+// spidev device, or any io.Writer (like a bytes.Buffer) for tests.
+type Strip struct {
+	w          io.Writer
+	count      int
+	white      bool
+	brightness int
+
+	mutex   sync.Mutex
+	pattern Pattern
+	changed chan struct{}
+}
+
+func NewStrip(w io.Writer, count int, white bool, brightness int) *Strip {
+	if brightness <= 0 || brightness > 255 {
+		brightness = 255
+	}
+	return &Strip{w: w, count: count, white: white, brightness: brightness, changed: make(chan struct{}, 1)}
+}
+
+// Frame renders the current pattern at step, as SPI bytes
+func (s *Strip) Frame(step int) []byte {
+	s.mutex.Lock()
+	p := s.pattern
+	s.mutex.Unlock()
+	frame := make([]Color, s.count)
+	if len(p.Colors) > 0 {
+		p.Render(frame, step)
+	}
+	return Encode(frame, s.white, s.brightness)
+}
+
+// SetPattern switches to a new pattern string
+func (s *Strip) SetPattern(str string) error {
+	p, err := ParsePattern(str)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.pattern = p
+	s.mutex.Unlock()
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run draws frames forever
+func (s *Strip) Run() {
+	step := 0
+	for {
+		if _, err := s.w.Write(s.Frame(step)); err != nil {
+			fmt.Println("LED strip write error:", err)
+		}
+		step++
+
+		s.mutex.Lock()
+		p := s.pattern
+		s.mutex.Unlock()
+		if p.Static() || len(p.Colors) == 0 {
+			<-s.changed
+			step = 0
+			continue
+		}
+		select {
+		case <-s.changed:
+			step = 0
+		case <-time.After(p.Speed):
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package ws2812
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WS2812/SK6812 addressable LEDs, driven from SPI MOSI. Each LED data bit
+// goes out as three SPI bits at 2.4MHz - 110 for a one, 100 for a zero -
+// which lands inside the LEDs' timing windows.
+//
+// Patterns use the same "@mode !speed colors" strings as neotool:
+//   @0 solid, @1 chase, @2 blink, @3 pulse
+//   !speed is microseconds per animation step
+//   colors are hex BBGGRR, space separated. Several colors repeat along
+//   the strip.
+
+const (
+	ModeSolid = 0
+	ModeChase = 1
+	ModeBlink = 2
+	ModePulse = 3
+
+	// Steps in one blink or pulse cycle
+	CycleSteps = 32
+
+	SPIHz = 2400000
+
+	// Low bytes after a frame to latch it - 320us. Current WS2812B parts
+	// want over 280us.
+	ResetBytes = 96
+)
+
+// Color is 0xBBGGRR, as in pattern strings
+type Color uint32
+
+func (c Color) R() byte { return byte(c) }
+func (c Color) G() byte { return byte(c >> 8) }
+func (c Color) B() byte { return byte(c >> 16) }
+
+// Scale by level/255
+func (c Color) Scale(level int) Color {
+	s := func(v byte) Color { return Color(int(v) * level / 255) }
+	return s(c.B())<<16 | s(c.G())<<8 | s(c.R())
+}
+
+type Pattern struct {
+	Mode   int
+	Speed  time.Duration
+	Colors []Color
+}
+
+// ParsePattern reads a pattern string like "@3 !150000 400000"
+func ParsePattern(s string) (Pattern, error) {
+	p := Pattern{Mode: ModeSolid, Speed: 100 * time.Millisecond}
+	for _, f := range strings.Fields(s) {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			m, err := strconv.Atoi(f[1:])
+			if err != nil {
+				return p, fmt.Errorf("bad mode %q", f)
+			}
+			p.Mode = m
+		case strings.HasPrefix(f, "!"):
+			us, err := strconv.Atoi(f[1:])
+			if err != nil || us <= 0 {
+				return p, fmt.Errorf("bad speed %q", f)
+			}
+			p.Speed = time.Duration(us) * time.Microsecond
+		default:
+			c, err := strconv.ParseUint(f, 16, 32)
+			if err != nil || c > 0xffffff {
+				return p, fmt.Errorf("bad color %q", f)
+			}
+			p.Colors = append(p.Colors, Color(c))
+		}
+	}
+	if len(p.Colors) == 0 {
+		return p, errors.New("no colors")
+	}
+	return p, nil
+}
+
+// Render fills frame with the pattern as it is at step
+func (p Pattern) Render(frame []Color, step int) {
+	n := len(frame)
+	for i := range frame {
+		frame[i] = p.Colors[i%len(p.Colors)]
+	}
+	switch p.Mode {
+	case ModeChase:
+		// One lit pixel (of each color) running along the strip
+		if n == 0 {
+			return
+		}
+		lit := step % n
+		for i := range frame {
+			if i != lit {
+				frame[i] = 0
+			} else {
+				frame[i] = p.Colors[(step/n)%len(p.Colors)]
+			}
+		}
+	case ModeBlink:
+		if step%CycleSteps >= CycleSteps/2 {
+			for i := range frame {
+				frame[i] = 0
+			}
+		}
+	case ModePulse:
+		// Triangle ramp up and down
+		s := step % CycleSteps
+		if s >= CycleSteps/2 {
+			s = CycleSteps - 1 - s
+		}
+		level := 255 * (s + 1) / (CycleSteps / 2)
+		for i := range frame {
+			frame[i] = frame[i].Scale(level)
+		}
+	}
+}
+
+// Static patterns never need redrawing
+func (p Pattern) Static() bool {
+	return p.Mode != ModeChase && p.Mode != ModeBlink && p.Mode != ModePulse
+}
+
+// Encode turns a frame into SPI bytes. white adds the W byte of SK6812
+// RGBW strips. brightness is 0-255.
+func Encode(frame []Color, white bool, brightness int) []byte {
+	var bits []byte
+	var acc, nacc uint
+	put := func(b byte) {
+		for i := 7; i >= 0; i-- {
+			code := uint(0x4) // 100
+			if b&(1<<uint(i)) != 0 {
+				code = 0x6 // 110
+			}
+			acc = acc<<3 | code
+			nacc += 3
+			for nacc >= 8 {
+				bits = append(bits, byte(acc>>(nacc-8)))
+				nacc -= 8
+			}
+		}
+	}
+	for _, c := range frame {
+		c = c.Scale(brightness)
+		put(c.G())
+		put(c.R())
+		put(c.B())
+		if white {
+			put(0)
+		}
+	}
+	if nacc > 0 {
+		bits = append(bits, byte(acc<<(8-nacc)))
+	}
+	return append(bits, make([]byte, ResetBytes)...)
+}
+
+// FrameSize is the SPI bytes for a strip of count LEDs - 9 per RGB LED,
+// 12 per RGBW
+func FrameSize(count int, white bool) int {
+	perLED := 3
+	if white {
+		perLED = 4
+	}
+	return count*perLED*3 + ResetBytes
+}
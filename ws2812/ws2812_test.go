@@ -0,0 +1,125 @@
+package ws2812
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParsePattern(t *testing.T) {
+	p, err := ParsePattern("@3 !150000 400000 ff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Mode != ModePulse || p.Speed != 150*time.Millisecond || len(p.Colors) != 2 || p.Colors[0] != 0x400000 || p.Colors[1] != 0xff {
+		t.Errorf("got %+v", p)
+	}
+	for _, bad := range []string{"@x", "!0", "!-5", "1000000", "zz"} {
+		if _, err := ParsePattern(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	frame := make([]Color, 4)
+	render := func(s string, step int) []Color {
+		p, err := ParsePattern(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Render(frame, step)
+		return append([]Color(nil), frame...)
+	}
+	same := func(name string, got []Color, want ...Color) {
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %06x, want %06x", name, got, want)
+				return
+			}
+		}
+	}
+
+	same("solid", render("@0 ff 8000", 0), 0xff, 0x8000, 0xff, 0x8000)
+	same("chase", render("@1 ff 8000", 1), 0, 0xff, 0, 0)
+	same("chase second lap", render("@1 ff 8000", 5), 0, 0x8000, 0, 0)
+	same("blink on", render("@2 ff", 0), 0xff, 0xff, 0xff, 0xff)
+	same("blink off", render("@2 ff", CycleSteps/2), 0, 0, 0, 0)
+	same("pulse bottom", render("@3 ff", 0), 0x0f, 0x0f, 0x0f, 0x0f)
+	same("pulse top", render("@3 ff", CycleSteps/2-1), 0xff, 0xff, 0xff, 0xff)
+	same("pulse down", render("@3 ff", CycleSteps-1), 0x0f, 0x0f, 0x0f, 0x0f)
+}
+
+func TestEncode(t *testing.T) {
+	// Green 0x80 first, then red 0, then blue 0xff: 110 100 100 100 100 100 100 100
+	// is 0xd2 0x49 0x24, 100 x8 is 0x92 0x49 0x24, 110 x8 is 0xdb 0x6d 0xb6
+	got := Encode([]Color{0xff8000}, false, 255)
+	want := append([]byte{0xd2, 0x49, 0x24, 0x92, 0x49, 0x24, 0xdb, 0x6d, 0xb6}, make([]byte, ResetBytes)...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got % x\nwant % x", got, want)
+	}
+	if len(got) != FrameSize(1, false) {
+		t.Errorf("FrameSize %d, encoded %d", FrameSize(1, false), len(got))
+	}
+	if n := len(Encode(make([]Color, 7), true, 255)); n != FrameSize(7, true) {
+		t.Errorf("RGBW FrameSize %d, encoded %d", FrameSize(7, true), n)
+	}
+	// Half brightness - 0x80 red becomes 0x40: 100 110 100 100 100 100 100 100
+	if got := Encode([]Color{0x80}, false, 128); got[0] != 0x92 || got[3] != 0x9a {
+		t.Errorf("half brightness got % x", got[:9])
+	}
+}
+
+// Captures each frame the strip writes
+type frameWriter chan []byte
+
+func (w frameWriter) Write(p []byte) (int, error) {
+	w <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func TestStrip(t *testing.T) {
+	frames := make(frameWriter, 16)
+	s := NewStrip(frames, 3, false, 0)
+	if err := s.SetPattern("@2 !1000 ff"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPattern("@9 nonsense"); err == nil {
+		t.Error("bad pattern accepted")
+	}
+	go s.Run()
+
+	on := Encode([]Color{0xff, 0xff, 0xff}, false, 255)
+	off := Encode(make([]Color, 3), false, 255)
+	seen := map[bool]bool{}
+	timeout := time.After(5 * time.Second)
+	for len(seen) < 2 {
+		select {
+		case f := <-frames:
+			switch {
+			case bytes.Equal(f, on):
+				seen[true] = true
+			case bytes.Equal(f, off):
+				seen[false] = true
+			default:
+				t.Fatalf("unexpected frame % x", f)
+			}
+		case <-timeout:
+			t.Fatalf("blink never showed both frames: %v", seen)
+		}
+	}
+
+	// A static pattern draws once and waits
+	s.SetPattern("@0 8000")
+	want := Encode([]Color{0x8000, 0x8000, 0x8000}, false, 255)
+	for {
+		select {
+		case f := <-frames:
+			if bytes.Equal(f, want) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("solid pattern never drawn")
+		}
+	}
+}